@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+// resultFlag results in 1 if s has the given boolean attribute, 0 otherwise.
+func resultFlag(ctx *sqlite.Context, s *goquery.Selection, attribute string) {
+	if _, ok := s.Attr(attribute); ok {
+		ctx.ResultInt(1)
+	} else {
+		ctx.ResultInt(0)
+	}
+}
+
+/** html_scripts(document)
+ * A table value function returning a row for every <script> element in document, in document order.
+ * The index column is declared quoted, since index is a keyword in SQL.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ */
+var HtmlScriptsColumns = []vtab.Column{
+	{Name: "document", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+
+	{Name: `"index"`, Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "src", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "type", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "async", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "defer", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "body", Type: sqlite.SQLITE_TEXT.String()},
+}
+
+type HtmlScriptsCursor struct {
+	current int
+
+	scripts *goquery.Selection
+}
+
+func (cur *HtmlScriptsCursor) Column(ctx *sqlite.Context, c int) error {
+	script := cur.scripts.Eq(cur.current)
+
+	col := HtmlScriptsColumns[c].Name
+	switch col {
+	case "document":
+		ctx.ResultText("")
+
+	case `"index"`:
+		ctx.ResultInt(cur.current)
+	case "src":
+		if src, ok := script.Attr("src"); ok {
+			ctx.ResultText(src)
+		} else {
+			ctx.ResultNull()
+		}
+	case "type":
+		if t, ok := script.Attr("type"); ok {
+			ctx.ResultText(t)
+		} else {
+			ctx.ResultNull()
+		}
+	case "async":
+		resultFlag(ctx, script, "async")
+	case "defer":
+		resultFlag(ctx, script, "defer")
+	case "body":
+		// browsers ignore the contents of external scripts
+		if _, ok := script.Attr("src"); ok {
+			ctx.ResultNull()
+		} else {
+			ctx.ResultText(script.Text())
+		}
+	}
+	return nil
+}
+
+func (cur *HtmlScriptsCursor) Next() (vtab.Row, error) {
+	cur.current += 1
+	if cur.current >= cur.scripts.Size() {
+		return nil, io.EOF
+	}
+	return cur, nil
+}
+
+func HtmlScriptsIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, _ := htmlEachArgs(constraints)
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_scripts: failed to parse document: %w", err)
+	}
+
+	scripts := doc.Find("script")
+	current := -1
+
+	return &HtmlScriptsCursor{
+		current: current,
+		scripts: scripts,
+	}, nil
+}
+
+/** html_styles(document)
+ * A table value function returning a row for every <link rel="stylesheet"> and <style> element
+ * in document, in document order.
+ * The index column is declared quoted, like in html_scripts.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ */
+var HtmlStylesColumns = []vtab.Column{
+	{Name: "document", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+
+	{Name: `"index"`, Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "kind", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "href", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "media", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "body", Type: sqlite.SQLITE_TEXT.String()},
+}
+
+type HtmlStylesCursor struct {
+	current int
+
+	styles *goquery.Selection
+}
+
+func (cur *HtmlStylesCursor) Column(ctx *sqlite.Context, c int) error {
+	style := cur.styles.Eq(cur.current)
+	inline := goquery.NodeName(style) == "style"
+
+	col := HtmlStylesColumns[c].Name
+	switch col {
+	case "document":
+		ctx.ResultText("")
+
+	case `"index"`:
+		ctx.ResultInt(cur.current)
+	case "kind":
+		if inline {
+			ctx.ResultText("inline")
+		} else {
+			ctx.ResultText("external")
+		}
+	case "href":
+		if href, ok := style.Attr("href"); ok && !inline {
+			ctx.ResultText(href)
+		} else {
+			ctx.ResultNull()
+		}
+	case "media":
+		if media, ok := style.Attr("media"); ok {
+			ctx.ResultText(media)
+		} else {
+			ctx.ResultNull()
+		}
+	case "body":
+		if inline {
+			ctx.ResultText(style.Text())
+		} else {
+			ctx.ResultNull()
+		}
+	}
+	return nil
+}
+
+func (cur *HtmlStylesCursor) Next() (vtab.Row, error) {
+	cur.current += 1
+	if cur.current >= cur.styles.Size() {
+		return nil, io.EOF
+	}
+	return cur, nil
+}
+
+// isStyleSource reports whether s is a source of CSS: either a <style> element,
+// or a <link> with "stylesheet" among its rel keywords.
+func isStyleSource(i int, s *goquery.Selection) bool {
+	switch goquery.NodeName(s) {
+	case "style":
+		return true
+	case "link":
+		for _, rel := range strings.Fields(s.AttrOr("rel", "")) {
+			if strings.EqualFold(rel, "stylesheet") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func HtmlStylesIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, _ := htmlEachArgs(constraints)
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_styles: failed to parse document: %w", err)
+	}
+
+	styles := doc.Find("link[rel], style").FilterFunction(isStyleSource)
+	current := -1
+
+	return &HtmlStylesCursor{
+		current: current,
+		styles:  styles,
+	}, nil
+}
+
+func RegisterAssets(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateModule("html_scripts", vtab.NewTableFunc("html_scripts", HtmlScriptsColumns, HtmlScriptsIterator)); err != nil {
+		return err
+	}
+	if err = api.CreateModule("html_styles", vtab.NewTableFunc("html_styles", HtmlStylesColumns, HtmlStylesIterator)); err != nil {
+		return err
+	}
+	return nil
+}
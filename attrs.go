@@ -1,10 +1,11 @@
 package main
 
 import (
-	"strings"
+	"encoding/json"
 
 	"github.com/PuerkitoBio/goquery"
 	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
 )
 
 /**		html_attribute_get(document, selector, name)
@@ -16,18 +17,22 @@ type HtmlAttributeGetFunc struct{}
 func (*HtmlAttributeGetFunc) Deterministic() bool { return true }
 func (*HtmlAttributeGetFunc) Args() int           { return 3 }
 func (*HtmlAttributeGetFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	html := values[0].Text()
 	selector := values[1].Text()
 	attribute := values[2].Text()
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	doc, err := documentArg(values[0])
 
 	if err != nil {
 		c.ResultError(err)
 		return
 	}
 
-	attr, exists := doc.FindMatcher(goquery.Single(selector)).Attr(attribute)
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	attr, exists := match.Attr(attribute)
 
 	if !exists {
 		c.ResultNull()
@@ -40,6 +45,7 @@ func (*HtmlAttributeGetFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
 
 /**		html_attribute_has(document, selector, name)
  *		html_attr_has(document, selector, name)
+ *		html_attr_exists(document, selector, name)
  * Returns 1 or 0, if the "name" attribute from the element 
  * found in document, using selector, exists
  **/
@@ -49,18 +55,22 @@ type HtmlAttributeHasFunc struct{}
 func (*HtmlAttributeHasFunc) Deterministic() bool { return true }
 func (*HtmlAttributeHasFunc) Args() int           { return 3 }
 func (*HtmlAttributeHasFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	html := values[0].Text()
 	selector := values[1].Text()
 	attribute := values[2].Text()
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	doc, err := documentArg(values[0])
 
 	if err != nil {
 		c.ResultError(err)
 		return
 	}
 
-	_, exists := doc.FindMatcher(goquery.Single(selector)).Attr(attribute)
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	_, exists := match.Attr(attribute)
 
 	if !exists {
 		c.ResultInt(0)
@@ -70,6 +80,144 @@ func (*HtmlAttributeHasFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
 
 }
 
+/**		html_attr_all(document, selector, name)
+ *	Returns a JSON array of the "name" attribute values of every element found in document,
+ *	using selector. Elements without the attribute are skipped.
+ **/
+type HtmlAttrAllFunc struct{}
+
+func (*HtmlAttrAllFunc) Deterministic() bool { return true }
+func (*HtmlAttrAllFunc) Args() int           { return 3 }
+func (*HtmlAttrAllFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	attribute := values[2].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	attrs := []string{}
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Each(func(i int, s *goquery.Selection) {
+		if attr, exists := s.Attr(attribute); exists {
+			attrs = append(attrs, attr)
+		}
+	})
+
+	result, err := json.Marshal(attrs)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(string(result))
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+/**		html_count_attr(document, selector, name)
+ *		html_count_missing_attr(document, selector, name)
+ *	Returns the number of elements found in document, using selector, that have
+ *	(or, for html_count_missing_attr, don't have) the "name" attribute.
+ **/
+type HtmlCountAttrFunc struct {
+	missing bool
+}
+
+func (*HtmlCountAttrFunc) Deterministic() bool { return true }
+func (*HtmlCountAttrFunc) Args() int           { return 3 }
+func (h *HtmlCountAttrFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	attribute := values[2].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	count := 0
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Each(func(i int, s *goquery.Selection) {
+		if _, exists := s.Attr(attribute); exists != h.missing {
+			count++
+		}
+	})
+
+	c.ResultInt(count)
+}
+
+// inheritedLang returns the language of n, from the lang attribute of n or of its nearest
+// ancestor that has one. Like in HTML, xml:lang takes precedence over lang on SVG and MathML elements.
+func inheritedLang(n *html.Node) (string, bool) {
+	for ; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, attr := range n.Attr {
+			if attr.Namespace == "xml" && attr.Key == "lang" {
+				return attr.Val, true
+			}
+		}
+		if lang, ok := nodeAttr(n, "lang"); ok {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+/**		html_lang(document [, selector])
+ *	Returns the language of the element found in document, using selector, or of the
+ *	whole document without one. Elements without a lang attribute inherit the language
+ *	of their nearest ancestor with one, up to <html lang>. NULL if there's none.
+ **/
+type HtmlLangFunc struct {
+	nArgs int
+}
+
+func (*HtmlLangFunc) Deterministic() bool { return true }
+func (h *HtmlLangFunc) Args() int         { return h.nArgs }
+func (*HtmlLangFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// the root <html> element
+	match := doc.Children()
+	if len(values) > 1 {
+		if match, err = findFirst(doc.Selection, values[1].Text()); err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	lang, ok := inheritedLang(match.Get(0))
+	if !ok {
+		c.ResultNull()
+		return
+	}
+
+	c.ResultText(lang)
+}
+
 func RegisterAttrs(api *sqlite.ExtensionApi) error {
 	var err error
 	if err = api.CreateFunction("html_attribute_get", &HtmlAttributeGetFunc{}); err != nil {
@@ -84,5 +232,23 @@ func RegisterAttrs(api *sqlite.ExtensionApi) error {
 	if err = api.CreateFunction("html_attr_has", &HtmlAttributeHasFunc{}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_attr_exists", &HtmlAttributeHasFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_attr_all", &HtmlAttrAllFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_count_attr", &HtmlCountAttrFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_count_missing_attr", &HtmlCountAttrFunc{missing: true}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_lang", &HtmlLangFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_lang", &HtmlLangFunc{nArgs: 2}); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HtmlDocument is a parsed HTML document, along with the source it was parsed from.
+// html_parse() passes these between functions with SQLite's pointer-passing interface,
+// so chained calls can skip re-parsing the same document.
+type HtmlDocument struct {
+	*goquery.Document
+	Source string
+}
+
+func parseHtmlDocument(source string) (*HtmlDocument, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	return &HtmlDocument{Document: doc, Source: source}, nil
+}
+
+// parseHtmlFragment parses source as the contents of a <body> element, instead of
+// as a full document, so the parser doesn't wrap it in <html>, <head>, and <body>.
+// The parsed nodes are the children of the returned document's root node.
+func parseHtmlFragment(source string) (*goquery.Document, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(source), context)
+	if err != nil {
+		return nil, err
+	}
+	root := &html.Node{Type: html.DocumentNode}
+	for _, node := range nodes {
+		root.AppendChild(node)
+	}
+	return goquery.NewDocumentFromNode(root), nil
+}
+
+// documentSource returns the HTML text passed in value. BLOBs, like the output
+// of readfile(), are raw bytes in any encoding, so they're decoded to UTF-8 first.
+func documentSource(value sqlite.Value) (string, error) {
+	if value.Type() == sqlite.SQLITE_BLOB {
+		return decodeHtml(value.Blob(), "")
+	}
+	return value.Text(), nil
+}
+
+// parseDocumentArg parses the HTML text or BLOB passed in value.
+func parseDocumentArg(value sqlite.Value) (*HtmlDocument, error) {
+	source, err := documentSource(value)
+	if err != nil {
+		return nil, err
+	}
+	return parseHtmlDocument(source)
+}
+
+// documentArg returns the document passed in value, either reusing a handle
+// returned by html_parse(), or parsing the value as HTML.
+func documentArg(value sqlite.Value) (*HtmlDocument, error) {
+	if handle, ok := value.Pointer().(*HtmlDocument); ok {
+		return handle, nil
+	}
+	return parseDocumentArg(value)
+}
+
+// modifiableDocumentArg is like documentArg, but copies handles returned by
+// html_parse(), so that modifying the document leaves the handle untouched.
+func modifiableDocumentArg(value sqlite.Value) (*HtmlDocument, error) {
+	if handle, ok := value.Pointer().(*HtmlDocument); ok {
+		clone := handle.Selection.Clone()
+		return &HtmlDocument{Document: goquery.NewDocumentFromNode(clone.Get(0)), Source: handle.Source}, nil
+	}
+	return parseDocumentArg(value)
+}
+
+/** html_parse(document)
+ * Parses document once, and returns an opaque handle to the parsed document that
+ * other sqlite-html functions accept in place of HTML text, to avoid re-parsing in chained calls.
+ * The handle is only visible to sqlite-html functions, and appears as NULL anywhere else.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to parse.
+ */
+type HtmlParseFunc struct{}
+
+func (*HtmlParseFunc) Deterministic() bool { return true }
+func (*HtmlParseFunc) Args() int           { return 1 }
+func (*HtmlParseFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultPointer(doc)
+}
+
+func RegisterDocument(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_parse", &HtmlParseFunc{}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"go.riyazali.net/sqlite"
@@ -34,8 +33,7 @@ const JSON_SUBTYPE = 74
  func (*HtmlFunc) Deterministic() bool { return true }
  func (*HtmlFunc) Args() int           { return 1 }
  func (*HtmlFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	 html := values[0].Text()
-	 doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	 doc, err := documentArg(values[0])
  
 	 if err != nil {
 		 c.ResultError(err)
@@ -219,6 +217,101 @@ func (s *HtmlGroupElementFunc) Final(ctx *sqlite.AggregateContext) {
 	}
 }
 
+/** html_agg(fragment [, separator])
+ * An aggregate function that concatenates the given HTML fragments, like group_concat,
+ * but returns the result as HTML. NULL fragments are skipped.
+ * @param fragment {text | html} - HTML fragment to concatenate.
+ * @param separator {text} - Text to place between fragments, defaults to an empty string.
+ */
+type HtmlAggFunc struct {
+	nArgs int
+}
+
+func (h *HtmlAggFunc) Args() int           { return h.nArgs }
+func (h *HtmlAggFunc) Deterministic() bool { return true }
+
+type HtmlAggContext struct {
+	buf   bytes.Buffer
+	count int
+}
+
+func (s *HtmlAggFunc) Step(ctx *sqlite.AggregateContext, values ...sqlite.Value) {
+	if ctx.Data() == nil {
+		ctx.SetData(&HtmlAggContext{})
+	}
+
+	var aCtx = ctx.Data().(*HtmlAggContext)
+	if values[0].Type() == sqlite.SQLITE_NULL {
+		return
+	}
+	if aCtx.count > 0 && len(values) > 1 {
+		aCtx.buf.WriteString(values[1].Text())
+	}
+	aCtx.buf.WriteString(values[0].Text())
+	aCtx.count++
+}
+
+func (s *HtmlAggFunc) Final(ctx *sqlite.AggregateContext) {
+	if ctx.Data() != nil {
+		var aCtx = ctx.Data().(*HtmlAggContext)
+		ctx.ResultText(aCtx.buf.String())
+		ctx.ResultSubType(HTML_SUBTYPE)
+	}
+}
+
+// moveChildren moves every child of src to the end of dst, in order.
+func moveChildren(dst, src *html.Node) {
+	for child := src.FirstChild; child != nil; child = src.FirstChild {
+		src.RemoveChild(child)
+		dst.AppendChild(child)
+	}
+}
+
+/** html_concat(document1, document2, ...)
+ * Combines the given documents into a single document, with the contents of each document's
+ * <head> and <body> appended to the result's <head> and <body>, in argument order.
+ * NULL documents are skipped.
+ * Raises an error if a document is not proper HTML.
+ * @param document {text | html} - HTML documents to combine.
+ */
+type HtmlConcatFunc struct{}
+
+func (*HtmlConcatFunc) Deterministic() bool { return true }
+func (*HtmlConcatFunc) Args() int           { return -1 }
+func (*HtmlConcatFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	result, err := parseHtmlDocument("")
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	head := result.Find("head").Get(0)
+	body := result.Find("body").Get(0)
+
+	for _, value := range values {
+		if value.Type() == sqlite.SQLITE_NULL && value.Pointer() == nil {
+			continue
+		}
+
+		doc, err := modifiableDocumentArg(value)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+
+		moveChildren(head, doc.Find("head").Get(0))
+		moveChildren(body, doc.Find("body").Get(0))
+	}
+
+	out, err := goquery.OuterHtml(result.Selection)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
 func RegisterElements(api *sqlite.ExtensionApi) error {
 	var err error
 	if err = api.CreateFunction("html", &HtmlFunc{}); err != nil {
@@ -233,5 +326,14 @@ func RegisterElements(api *sqlite.ExtensionApi) error {
 	if err = api.CreateFunction("html_group_element_span", &HtmlGroupElementFunc{parent: "span"}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_agg", &HtmlAggFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_agg", &HtmlAggFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_concat", &HtmlConcatFunc{}); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+)
+
+/** html_select_options(document, selector)
+ * A table value function returning a row for every <option> inside the first <select> element
+ * in document matching selector.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which select element in document to read.
+ */
+var HtmlSelectOptionsColumns = []vtab.Column{
+	{Name: "document", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+	{Name: "selector", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+
+	{Name: "value", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "label", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "selected", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "disabled", Type: sqlite.SQLITE_INTEGER.String()},
+}
+
+type HtmlSelectOptionsCursor struct {
+	current int
+
+	options *goquery.Selection
+}
+
+func (cur *HtmlSelectOptionsCursor) Column(ctx *sqlite.Context, c int) error {
+	option := cur.options.Eq(cur.current)
+
+	col := HtmlSelectOptionsColumns[c].Name
+	switch col {
+	case "document":
+		ctx.ResultText("")
+	case "selector":
+		ctx.ResultText("")
+
+	case "value":
+		// options without a value attribute use their text instead
+		if value, ok := option.Attr("value"); ok {
+			ctx.ResultText(value)
+		} else {
+			ctx.ResultText(strings.Join(strings.Fields(option.Text()), " "))
+		}
+	case "label":
+		if label, ok := option.Attr("label"); ok {
+			ctx.ResultText(label)
+		} else {
+			ctx.ResultText(strings.Join(strings.Fields(option.Text()), " "))
+		}
+	case "selected":
+		if _, ok := option.Attr("selected"); ok {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "disabled":
+		// options inside a disabled <optgroup> or <select> are disabled too, but other
+		// elements don't have a disabled state to pass on
+		if option.Closest("option[disabled], optgroup[disabled], select[disabled]").Length() > 0 {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	}
+	return nil
+}
+
+func (cur *HtmlSelectOptionsCursor) Next() (vtab.Row, error) {
+	cur.current += 1
+	if cur.current >= cur.options.Size() {
+		return nil, io.EOF
+	}
+	return cur, nil
+}
+
+func HtmlSelectOptionsIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, selector := htmlEachArgs(constraints)
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_select_options: failed to parse document: %w", err)
+	}
+
+	selectElement, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		return nil, fmt.Errorf("html_select_options: %w", err)
+	}
+	options := selectElement.Find("option")
+	current := -1
+
+	return &HtmlSelectOptionsCursor{
+		current: current,
+		options: options,
+	}, nil
+}
+
+func RegisterForms(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateModule("html_select_options", vtab.NewTableFunc("html_select_options", HtmlSelectOptionsColumns, HtmlSelectOptionsIterator)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,12 +4,13 @@ go 1.17
 
 require (
 	github.com/PuerkitoBio/goquery v1.7.1
+	github.com/andybalholm/cascadia v1.2.0
 	github.com/augmentable-dev/vtab v0.0.0-20210818144031-5c7659b723dd
 	go.riyazali.net/sqlite v0.0.0-20211025103955-e79f04eecc1d
 	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
 )
 
 require (
-	github.com/andybalholm/cascadia v1.2.0 // indirect
 	github.com/mattn/go-pointer v0.0.1 // indirect
+	golang.org/x/text v0.3.6 // indirect
 )
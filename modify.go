@@ -0,0 +1,808 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// isFullDocument reports whether source spells out its own doctype, <html>,
+// <head>, or <body>, rather than being a fragment that the parser wrapped.
+// Only real tags count, not lookalikes like <header> or text inside comments,
+// scripts, or attribute values.
+func isFullDocument(source string) bool {
+	z := html.NewTokenizer(strings.NewReader(source))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+		case html.DoctypeToken:
+			return true
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Html, atom.Head, atom.Body:
+				return true
+			}
+		}
+	}
+}
+
+// renderDocument serializes a modified document back to HTML. Like html(),
+// fragments are returned without the "<html><body>" wrapper goquery adds,
+// while full documents are rendered in their entirety.
+func renderDocument(doc *HtmlDocument) (string, error) {
+	if isFullDocument(doc.Source) {
+		return goquery.OuterHtml(doc.Selection)
+	}
+	return doc.Find("body").Html()
+}
+
+// largestTextBlock guesses which element under root holds the main content, once boilerplate
+// is removed: the parent of the text blocks that html_text_blocks would return with the most
+// text between them. Returns nil if root has no text blocks.
+func largestTextBlock(root *html.Node) *html.Node {
+	sizes := map[*html.Node]int{}
+	var best *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.Data == "script" || child.Data == "style" {
+				continue
+			}
+			if textBlockElements[child.Data] && n.Type == html.ElementNode {
+				sizes[n] += utf8.RuneCountInString(blockText(child))
+				// ties go to the container that comes first
+				if best == nil || sizes[n] > sizes[best] {
+					best = n
+				}
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	if best == nil || sizes[best] == 0 {
+		return nil
+	}
+	return best
+}
+
+/** html_remove(document, selector)
+ * Removes every element matching selector from document, and returns the modified document.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to remove.
+ */
+type HtmlRemoveFunc struct {
+	nArgs int
+}
+
+func (*HtmlRemoveFunc) Deterministic() bool { return true }
+func (h *HtmlRemoveFunc) Args() int         { return h.nArgs }
+func (*HtmlRemoveFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Remove()
+
+	if len(values) > 2 && values[2].Int() != 0 {
+		content := largestTextBlock(doc.Get(0))
+		if content == nil {
+			c.ResultNull()
+			return
+		}
+		// text blocks right inside <body> already are the main content
+		if content.Data != "body" && content.Data != "html" {
+			var buf strings.Builder
+			if err := html.Render(&buf, content); err != nil {
+				c.ResultError(err)
+				return
+			}
+			c.ResultText(buf.String())
+			c.ResultSubType(HTML_SUBTYPE)
+			return
+		}
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_strip(document, selector [, keep_largest])
+ * Removes every element matching selector from document, like html_remove, and returns the modified document.
+ * With a truthy keep_largest, only the element that holds the most text in its paragraphs, headings,
+ * and other text blocks afterwards is returned, or NULL if no text is left.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to remove.
+ * @param keep_largest {integer} - Whether to only keep the largest remaining block of text, defaults to 0.
+ */
+type HtmlStripFunc struct {
+	HtmlRemoveFunc
+}
+
+/** html_replace(document, selector, replacement)
+ * Replaces every element matching selector in document with the replacement HTML fragment,
+ * and returns the modified document. An empty replacement removes the matching elements.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to replace.
+ * @param replacement {text | html} - HTML fragment to insert in place of each match.
+ * 	The replacement is parsed leniently like any other HTML, so plain text becomes a text node
+ * 	and malformed markup is repaired by the parser instead of raising an error.
+ */
+type HtmlReplaceFunc struct{}
+
+func (*HtmlReplaceFunc) Deterministic() bool { return true }
+func (*HtmlReplaceFunc) Args() int           { return 3 }
+func (*HtmlReplaceFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	replacement := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	if replacement == "" {
+		matches.Remove()
+	} else {
+		matches.ReplaceWithHtml(replacement)
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_set_attr(document, selector, name, value)
+ * Sets the "name" attribute to value on every element matching selector in document,
+ * and returns the modified document. A NULL value removes the attribute instead.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to modify.
+ * @param name {text} - Name of the attribute to set.
+ * @param value {text | null} - New value of the attribute, or NULL to remove it.
+ */
+type HtmlSetAttrFunc struct{}
+
+func (*HtmlSetAttrFunc) Deterministic() bool { return true }
+func (*HtmlSetAttrFunc) Args() int           { return 4 }
+func (*HtmlSetAttrFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	name := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	if values[3].Type() == sqlite.SQLITE_NULL {
+		matches.RemoveAttr(name)
+	} else {
+		matches.SetAttr(name, values[3].Text())
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_add_class(document, selector, classes)
+ * Adds the given space-separated classes to every element matching selector in document,
+ * and returns the modified document. Classes an element already has are not duplicated.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to modify.
+ * @param classes {text} - One or more space-separated class names to add.
+ */
+type HtmlAddClassFunc struct{}
+
+func (*HtmlAddClassFunc) Deterministic() bool { return true }
+func (*HtmlAddClassFunc) Args() int           { return 3 }
+func (*HtmlAddClassFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	classes := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.AddClass(classes)
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_remove_class(document, selector, classes)
+ * Removes the given space-separated classes from every element matching selector in document,
+ * and returns the modified document. An empty classes argument removes all classes.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to modify.
+ * @param classes {text} - One or more space-separated class names to remove.
+ */
+type HtmlRemoveClassFunc struct{}
+
+func (*HtmlRemoveClassFunc) Deterministic() bool { return true }
+func (*HtmlRemoveClassFunc) Args() int           { return 3 }
+func (*HtmlRemoveClassFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	classes := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.RemoveClass(classes)
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_wrap(document, selector, wrapper)
+ * Wraps every element matching selector in document with its own copy of the wrapper
+ * HTML fragment, and returns the modified document. Each match is wrapped separately,
+ * inside the innermost first element of wrapper.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to wrap.
+ * @param wrapper {text | html} - HTML fragment to wrap around each match, like '<div class="x"></div>'.
+ */
+type HtmlWrapFunc struct{}
+
+func (*HtmlWrapFunc) Deterministic() bool { return true }
+func (*HtmlWrapFunc) Args() int           { return 3 }
+func (*HtmlWrapFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	wrapper := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.WrapHtml(wrapper)
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_unwrap(document, selector)
+ * Removes the parent of every element matching selector in document, keeping the parent's
+ * children in its place, and returns the modified document. Elements at the top level
+ * of the document have no parent to remove, and are left as-is.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to unwrap.
+ */
+type HtmlUnwrapFunc struct{}
+
+func (*HtmlUnwrapFunc) Deterministic() bool { return true }
+func (*HtmlUnwrapFunc) Args() int           { return 2 }
+func (*HtmlUnwrapFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// goquery already skips <body> parents, so top-level elements stay put
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Unwrap()
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+var tagNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]*$`)
+
+// textNodes returns the text nodes inside nodes, in document order and without duplicates
+// when nodes are nested, skipping the contents of elements named in skip.
+func textNodes(nodes []*html.Node, skip ...string) []*html.Node {
+	var texts []*html.Node
+	seen := map[*html.Node]bool{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		if n.Type == html.TextNode {
+			texts = append(texts, n)
+		}
+		if n.Type == html.ElementNode {
+			for _, name := range skip {
+				if n.Data == name {
+					return
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return texts
+}
+
+// highlightText wraps every match of re in the text node n with a new tag element.
+func highlightText(n *html.Node, re *regexp.Regexp, tag string) {
+	text := n.Data
+	matches := re.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return
+	}
+
+	parent := n.Parent
+	last := 0
+	for _, match := range matches {
+		if match[0] > last {
+			parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[last:match[0]]}, n)
+		}
+		mark := &html.Node{Type: html.ElementNode, Data: tag, DataAtom: atom.Lookup([]byte(tag))}
+		mark.AppendChild(&html.Node{Type: html.TextNode, Data: text[match[0]:match[1]]})
+		parent.InsertBefore(mark, n)
+		last = match[1]
+	}
+	if last < len(text) {
+		parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[last:]}, n)
+	}
+	parent.RemoveChild(n)
+}
+
+/** html_highlight(document, selector, needle [, wrapper_tag [, case_insensitive]])
+ * Wraps every occurrence of needle in the text of elements matching selector in a <mark>
+ * element, or in a wrapper_tag element, and returns the modified document. Only text is
+ * searched, never attribute values or the contents of <script>, <style>, <textarea>, and <title>.
+ * Raises an error if document is not proper HTML, or if wrapper_tag is not a valid tag name.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to search.
+ * @param needle {text} - Text to highlight.
+ * @param wrapper_tag {text} - Tag name of the element wrapped around each occurrence, defaults to "mark".
+ * @param case_insensitive {integer} - Whether to ignore case when searching, defaults to 0.
+ */
+type HtmlHighlightFunc struct {
+	nArgs int
+}
+
+func (*HtmlHighlightFunc) Deterministic() bool { return true }
+func (h *HtmlHighlightFunc) Args() int         { return h.nArgs }
+func (*HtmlHighlightFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	needle := values[2].Text()
+	tag := "mark"
+	if len(values) > 3 && values[3].Type() != sqlite.SQLITE_NULL {
+		tag = strings.ToLower(values[3].Text())
+	}
+	if !tagNamePattern.MatchString(tag) {
+		c.ResultError(fmt.Errorf("invalid wrapper_tag %q", tag))
+		return
+	}
+
+	pattern := regexp.QuoteMeta(needle)
+	if len(values) > 4 && values[4].Int() != 0 {
+		pattern = "(?i)" + pattern
+	}
+	re := regexp.MustCompile(pattern)
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// collect the text nodes up front, so newly inserted wrappers aren't highlighted again
+	var texts []*html.Node
+	if needle != "" {
+		matches, err := findAll(doc.Selection, selector)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		texts = textNodes(matches.Nodes, "script", "style", "textarea", "title")
+	}
+	for _, text := range texts {
+		highlightText(text, re, tag)
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_replace_text(document, search, replacement [, selector])
+ * Replaces every occurrence of search in the text of document with replacement, and returns the
+ * modified document. With selector, only the text inside elements matching selector is changed.
+ * Tag names, attribute values, and the contents of <script> and <style> elements are left untouched.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param search {text} - Text to replace.
+ * @param replacement {text} - Text to replace search with.
+ * @param selector {text} - CSS-style selector of which elements in document to change, defaults to the whole document.
+ */
+type HtmlReplaceTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlReplaceTextFunc) Deterministic() bool { return true }
+func (h *HtmlReplaceTextFunc) Args() int         { return h.nArgs }
+func (*HtmlReplaceTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	search := values[1].Text()
+	replacement := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	if search != "" {
+		nodes := doc.Nodes
+		if len(values) > 3 {
+			matches, err := findAll(doc.Selection, values[3].Text())
+			if err != nil {
+				c.ResultError(err)
+				return
+			}
+			nodes = matches.Nodes
+		}
+		for _, text := range textNodes(nodes, "script", "style") {
+			text.Data = strings.ReplaceAll(text.Data, search, replacement)
+		}
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+// removeComments removes every comment node under n.
+func removeComments(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.CommentNode {
+			n.RemoveChild(child)
+		} else {
+			removeComments(child)
+		}
+		child = next
+	}
+}
+
+/** html_remove_comments(document)
+ * Removes every comment from document, including conditional comments, and returns the modified document.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ */
+type HtmlRemoveCommentsFunc struct{}
+
+func (*HtmlRemoveCommentsFunc) Deterministic() bool { return true }
+func (*HtmlRemoveCommentsFunc) Args() int           { return 1 }
+func (*HtmlRemoveCommentsFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// CSS selectors can't match comments, so walk the nodes directly
+	removeComments(doc.Get(0))
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+// cleanAttributes removes the event handler attributes from n and its descendants,
+// along with style attributes if style is set.
+func cleanAttributes(n *html.Node, style bool) {
+	if n.Type == html.ElementNode {
+		attrs := n.Attr[:0]
+		for _, attr := range n.Attr {
+			if strings.HasPrefix(attr.Key, "on") || (style && attr.Key == "style") {
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		n.Attr = attrs
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		cleanAttributes(child, style)
+	}
+}
+
+/** html_clean_attributes(document [, also_style])
+ * Removes every attribute whose name starts with "on", like onclick or onload, from every element
+ * in document, and returns the modified document. With also_style, style attributes are removed too.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param also_style {integer} - Whether to remove style attributes too, defaults to 0.
+ */
+type HtmlCleanAttributesFunc struct {
+	nArgs int
+}
+
+func (*HtmlCleanAttributesFunc) Deterministic() bool { return true }
+func (h *HtmlCleanAttributesFunc) Args() int         { return h.nArgs }
+func (*HtmlCleanAttributesFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	style := len(values) > 1 && values[1].Int() != 0
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	cleanAttributes(doc.Get(0), style)
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+// Elements that html_strip_empty keeps even without any content, since they're part of
+// the page's structure, or get their content from elsewhere.
+var keepEmptyElements = map[string]bool{
+	"html": true, "head": true, "body": true, "script": true, "style": true, "textarea": true,
+	"iframe": true, "canvas": true, "video": true, "audio": true, "object": true, "svg": true, "math": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "td": true, "th": true, "colgroup": true,
+}
+
+// stripEmpty removes the elements inside n without any text or void elements in them,
+// and reports whether n has any content left. Children are stripped first, so
+// wrappers around nothing but empty elements are removed too.
+func stripEmpty(n *html.Node) bool {
+	content := false
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch child.Type {
+		case html.TextNode:
+			if strings.TrimSpace(child.Data) != "" {
+				content = true
+			}
+		case html.ElementNode:
+			if stripEmpty(child) || voidElements[child.Data] || keepEmptyElements[child.Data] {
+				content = true
+			} else {
+				n.RemoveChild(child)
+			}
+		}
+		child = next
+	}
+	return content
+}
+
+/** html_strip_empty(document [, selector])
+ * Removes every element from document without any text or void elements like <br> or <img> inside it,
+ * including wrappers around nothing but empty elements, and returns the modified document.
+ * With selector, only elements inside the elements matching selector are removed.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to remove empty elements from.
+ */
+type HtmlStripEmptyFunc struct {
+	nArgs int
+}
+
+func (*HtmlStripEmptyFunc) Deterministic() bool { return true }
+func (h *HtmlStripEmptyFunc) Args() int         { return h.nArgs }
+func (*HtmlStripEmptyFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	scope := doc.Selection
+	if len(values) > 1 {
+		if scope, err = findAll(doc.Selection, values[1].Text()); err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+	for _, n := range scope.Nodes {
+		stripEmpty(n)
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+func RegisterModify(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_remove", &HtmlRemoveFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_strip", &HtmlStripFunc{HtmlRemoveFunc{nArgs: 2}}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_strip", &HtmlStripFunc{HtmlRemoveFunc{nArgs: 3}}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_replace", &HtmlReplaceFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_set_attr", &HtmlSetAttrFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_add_class", &HtmlAddClassFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_remove_class", &HtmlRemoveClassFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_wrap", &HtmlWrapFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_unwrap", &HtmlUnwrapFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_highlight", &HtmlHighlightFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_highlight", &HtmlHighlightFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_highlight", &HtmlHighlightFunc{nArgs: 5}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_replace_text", &HtmlReplaceTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_replace_text", &HtmlReplaceTextFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_remove_comments", &HtmlRemoveCommentsFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_clean_attributes", &HtmlCleanAttributesFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_clean_attributes", &HtmlCleanAttributesFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_strip_empty", &HtmlStripEmptyFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_strip_empty", &HtmlStripEmptyFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	return nil
+}
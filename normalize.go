@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+)
+
+// Elements whose text is kept exactly as written when normalizing.
+var preservedElements = map[string]bool{
+	"pre": true, "textarea": true, "script": true, "style": true,
+}
+
+// Elements that text doesn't flow around, in addition to blockElements, so
+// whitespace at their edges is insignificant.
+var layoutElements = map[string]bool{
+	"html": true, "head": true, "body": true, "base": true, "link": true, "meta": true,
+	"noscript": true, "template": true, "thead": true, "tbody": true, "tfoot": true,
+	"td": true, "th": true, "colgroup": true, "col": true, "optgroup": true, "option": true,
+}
+
+// isLayoutNode reports whether whitespace next to n, or at the edges of its
+// children, is insignificant. Missing siblings count as their parent's edge.
+func isLayoutNode(n *html.Node) bool {
+	switch n.Type {
+	case html.DocumentNode:
+		return true
+	case html.ElementNode:
+		return blockElements[n.Data] || layoutElements[n.Data]
+	}
+	return false
+}
+
+// collapseHTMLSpace replaces every run of HTML whitespace in s, meaning spaces, tabs,
+// and line breaks, with a single space. Non-breaking spaces are kept, since they aren't
+// collapsed when rendering either.
+func collapseHTMLSpace(s string) string {
+	var buf strings.Builder
+	space := false
+	for _, r := range s {
+		if strings.ContainsRune(" \t\n\f\r", r) {
+			space = true
+			continue
+		}
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteRune(r)
+	}
+	if space {
+		buf.WriteByte(' ')
+	}
+	return buf.String()
+}
+
+// collapseWhitespace collapses the whitespace in every text node inside n with
+// collapseHTMLSpace, leaving the text inside <pre>, <textarea>, <script>, and <style> as is.
+func collapseWhitespace(n *html.Node) {
+	if n.Type == html.ElementNode && preservedElements[n.Data] {
+		return
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			child.Data = collapseHTMLSpace(child.Data)
+		} else {
+			collapseWhitespace(child)
+		}
+	}
+}
+
+// normalizeNode rewrites n and its descendants in place into a canonical form:
+// attributes are sorted by name, runs of whitespace in text are collapsed to a
+// single space, and whitespace next to the start or end of block-level elements
+// is removed. Text inside <pre>, <textarea>, <script>, and <style> is left as is.
+func normalizeNode(n *html.Node) {
+	if n.Type == html.ElementNode {
+		sort.SliceStable(n.Attr, func(i, j int) bool {
+			if n.Attr[i].Namespace != n.Attr[j].Namespace {
+				return n.Attr[i].Namespace < n.Attr[j].Namespace
+			}
+			return n.Attr[i].Key < n.Attr[j].Key
+		})
+		if preservedElements[n.Data] {
+			return
+		}
+	}
+
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type != html.TextNode {
+			normalizeNode(child)
+			child = next
+			continue
+		}
+
+		text := collapseHTMLSpace(child.Data)
+		if (child.PrevSibling == nil && isLayoutNode(n)) || (child.PrevSibling != nil && isLayoutNode(child.PrevSibling)) {
+			text = strings.TrimLeft(text, " ")
+		}
+		if (next == nil && isLayoutNode(n)) || (next != nil && isLayoutNode(next)) {
+			text = strings.TrimRight(text, " ")
+		}
+		if text == "" {
+			n.RemoveChild(child)
+		} else {
+			child.Data = text
+		}
+		child = next
+	}
+}
+
+// normalizeDocument normalizes doc in place and serializes it as a full document.
+func normalizeDocument(doc *HtmlDocument) (string, error) {
+	normalizeNode(doc.Get(0))
+	return goquery.OuterHtml(doc.Selection)
+}
+
+/** html_normalize(document)
+ * Returns a canonical serialization of document, so that documents that only differ in formatting
+ * serialize identically. Attributes are sorted by name, insignificant whitespace is collapsed or removed,
+ * and the result is always a full document with <html>, <head>, and <body> elements.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to normalize.
+ */
+type HtmlNormalizeFunc struct{}
+
+func (*HtmlNormalizeFunc) Deterministic() bool { return true }
+func (*HtmlNormalizeFunc) Args() int           { return 1 }
+func (*HtmlNormalizeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	out, err := normalizeDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_equal(document_a, document_b)
+ * Returns 1 if document_a and document_b are the same after normalizing them like html_normalize,
+ * so differences in formatting or attribute order are ignored, and 0 otherwise.
+ * Raises an error if either document is not proper HTML.
+ * @param document_a {text | html} - HTML document to compare.
+ * @param document_b {text | html} - HTML document to compare.
+ */
+type HtmlEqualFunc struct{}
+
+func (*HtmlEqualFunc) Deterministic() bool { return true }
+func (*HtmlEqualFunc) Args() int           { return 2 }
+func (*HtmlEqualFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	var normalized [2]string
+	for i := range normalized {
+		doc, err := modifiableDocumentArg(values[i])
+
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+
+		normalized[i], err = normalizeDocument(doc)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+
+	if normalized[0] == normalized[1] {
+		c.ResultInt(1)
+	} else {
+		c.ResultInt(0)
+	}
+}
+
+/** html_dedupe(document, selector)
+ * Removes every element matching selector in document that's identical to an earlier match,
+ * and returns the modified document. Elements are compared after normalizing them like
+ * html_normalize, so differences in formatting or attribute order don't count.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to compare.
+ */
+type HtmlDedupeFunc struct{}
+
+func (*HtmlDedupeFunc) Deterministic() bool { return true }
+func (*HtmlDedupeFunc) Args() int           { return 2 }
+func (*HtmlDedupeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	seen := map[string]bool{}
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	dupes := matches.Slice(0, 0)
+	for i := range matches.Nodes {
+		match := matches.Eq(i)
+		// normalize a copy, so the kept elements are left as written
+		clone := match.Clone()
+		normalizeNode(clone.Get(0))
+		key, err := goquery.OuterHtml(clone)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		if seen[key] {
+			dupes = dupes.AddSelection(match)
+		}
+		seen[key] = true
+	}
+	dupes.Remove()
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_hash(document [, algorithm])
+ * Returns the hex digest of document after normalizing it like html_normalize, so documents
+ * that only differ in formatting or attribute order hash the same.
+ * Raises an error if document is not proper HTML, or if algorithm is unknown.
+ * @param document {text | html} - HTML document to hash.
+ * @param algorithm {text} - One of "sha256" (the default), "sha1", or "md5".
+ */
+type HtmlHashFunc struct {
+	nArgs int
+}
+
+func (*HtmlHashFunc) Deterministic() bool { return true }
+func (h *HtmlHashFunc) Args() int         { return h.nArgs }
+func (*HtmlHashFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	var hasher hash.Hash
+	algorithm := "sha256"
+	if len(values) > 1 && values[1].Type() != sqlite.SQLITE_NULL {
+		algorithm = strings.ToLower(values[1].Text())
+	}
+	switch algorithm {
+	case "sha256":
+		hasher = sha256.New()
+	case "sha1":
+		hasher = sha1.New()
+	case "md5":
+		hasher = md5.New()
+	default:
+		c.ResultError(fmt.Errorf("unknown algorithm %q, expected 'sha256', 'sha1', or 'md5'", algorithm))
+		return
+	}
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	normalized, err := normalizeDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	hasher.Write([]byte(normalized))
+	c.ResultText(hex.EncodeToString(hasher.Sum(nil)))
+}
+
+/** html_normalize_whitespace(document [, selector])
+ * Collapses every run of whitespace in the text of document to a single space, and returns the modified
+ * document. Whitespace-only text is kept as a single space, and text inside <pre>, <textarea>, <script>,
+ * and <style> is left as is. With selector, only the text inside the elements matching selector changes.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param selector {text} - CSS-style selector of which elements in document to normalize.
+ */
+type HtmlNormalizeWhitespaceFunc struct {
+	nArgs int
+}
+
+func (*HtmlNormalizeWhitespaceFunc) Deterministic() bool { return true }
+func (h *HtmlNormalizeWhitespaceFunc) Args() int         { return h.nArgs }
+func (*HtmlNormalizeWhitespaceFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	scope := doc.Selection
+	if len(values) > 1 {
+		if scope, err = findAll(doc.Selection, values[1].Text()); err != nil {
+			c.ResultError(err)
+			return
+		}
+		// matches inside preserved elements are left alone too
+		scope = scope.FilterFunction(func(i int, s *goquery.Selection) bool {
+			return s.ParentsFiltered("pre, textarea, script, style").Length() == 0
+		})
+	}
+	for _, n := range scope.Nodes {
+		collapseWhitespace(n)
+	}
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+func RegisterNormalize(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_normalize", &HtmlNormalizeFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_equal", &HtmlEqualFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_dedupe", &HtmlDedupeFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_hash", &HtmlHashFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_hash", &HtmlHashFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_normalize_whitespace", &HtmlNormalizeWhitespaceFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_normalize_whitespace", &HtmlNormalizeWhitespaceFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// sourceOffsets maps the elements under root, parsed from source, to the byte
+// offset of their start tag in source. goquery discards token positions, so
+// source is parsed again with every start tag marked by an attribute holding its
+// offset, and the elements of both trees are paired up. Since the marks are parsed
+// like any other attribute, elements that the parser moves, like misplaced table
+// content, keep their own offset. Elements the parser created on its own have no
+// start tag, and are missing from the map, and so are the copies it makes of
+// misnested formatting elements.
+func sourceOffsets(source string, root *html.Node) map[*html.Node]int {
+	// the mark's name can't be one that the document already uses
+	lower := strings.ToLower(source)
+	name := "data-sqlite-html-offset"
+	for strings.Contains(lower, name) {
+		name += "-"
+	}
+
+	var marked strings.Builder
+	z := html.NewTokenizer(strings.NewReader(source))
+	offset := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		raw := z.Raw()
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			// the mark goes right after the tag name, followed by a space so the rest of the tag reads the same
+			end := 1 + strings.IndexAny(string(raw[1:]), "\t\n\f\r />")
+			marked.Write(raw[:end])
+			marked.WriteString(" " + name + "=" + strconv.Itoa(offset) + " ")
+			marked.Write(raw[end:])
+		} else {
+			marked.Write(raw)
+		}
+		offset += len(raw)
+	}
+
+	markedRoot, err := html.Parse(strings.NewReader(marked.String()))
+	if err != nil {
+		return map[*html.Node]int{}
+	}
+
+	// pair up the elements of both trees in document order, while they're the same
+	type sourceElement struct {
+		node   *html.Node
+		offset int
+	}
+	var elements []sourceElement
+	seen := map[int]bool{}
+	var walk func(n, m *html.Node)
+	walk = func(n, m *html.Node) {
+		if n.Type == html.ElementNode {
+			for _, attr := range m.Attr {
+				if attr.Namespace != "" || attr.Key != name {
+					continue
+				}
+				// the first element with a mark is the one from the start tag, later ones are the parser's copies
+				if offset, err := strconv.Atoi(attr.Val); err == nil && !seen[offset] {
+					seen[offset] = true
+					elements = append(elements, sourceElement{node: n, offset: offset})
+				}
+			}
+		}
+		child, markedChild := n.FirstChild, m.FirstChild
+		for child != nil && markedChild != nil && child.Type == markedChild.Type && child.Data == markedChild.Data {
+			walk(child, markedChild)
+			child, markedChild = child.NextSibling, markedChild.NextSibling
+		}
+	}
+	walk(root, markedRoot)
+
+	offsets := map[*html.Node]int{}
+	for i, element := range elements {
+		// a later <html> or <body> tag only adds its attributes to the element that the parser
+		// created before, so it's not that element's start tag if an element after it starts earlier
+		if data := element.node.Data; (data == "html" || data == "body") && i+1 < len(elements) && elements[i+1].offset < element.offset {
+			continue
+		}
+		offsets[element.node] = element.offset
+	}
+	return offsets
+}
+
+// sourceLine returns the 1-based line number of the given byte offset in source.
+func sourceLine(source string, offset int) int {
+	return strings.Count(source[:offset], "\n") + 1
+}
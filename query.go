@@ -1,12 +1,18 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"regexp"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
 	"github.com/augmentable-dev/vtab"
 	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
 )
 
 /** html_text(document [, selector])
@@ -22,8 +28,7 @@ import (
  func (*HtmlTextFunc) Deterministic() bool { return true }
  func (h *HtmlTextFunc) Args() int           { return h.nArgs }
  func (*HtmlTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	 html := values[0].Text()
-	 doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	 doc, err := documentArg(values[0])
  
 	 if err != nil {
 		 c.ResultError(err)
@@ -31,91 +36,1353 @@ import (
 	 }
 	 if len(values) > 1 {
 		selector := values[1].Text()
-		c.ResultText(doc.FindMatcher(goquery.Single(selector)).Text())
+		match, err := findFirst(doc.Selection, selector)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		c.ResultText(match.Text())
 	 }else {
 		c.ResultText(doc.Text())
 	 } 
  }
 
-/** html_extract(document, selector)
- * Returns the entire HTML representation of the selected element from document, using selector.
+/** html_extract(document, selector [, n])
+ * Returns the entire HTML representation of the selected element from document, using selector.
+ * With n, returns the nth matching element instead of the first, like html_nth.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param n {integer} - 1-based position of the match to return, negative values count from the end.
+ */
+type HtmlExtractFunc struct {
+	nArgs int
+}
+
+func (*HtmlExtractFunc) Deterministic() bool { return true }
+func (h *HtmlExtractFunc) Args() int         { return h.nArgs }
+func (*HtmlExtractFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	var match *goquery.Selection
+	if len(values) > 2 {
+		if match, err = findAll(doc.Selection, selector); err == nil {
+			match = nthMatch(match, values[2].Int())
+		}
+	} else {
+		match, err = findFirst(doc.Selection, selector)
+	}
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	sub, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_extract_fragment(document, selector)
+ * Like html_extract, but parses document as an HTML fragment in the context of a <body> element,
+ * instead of as a full document, so it isn't wrapped in <html>, <head>, and <body> elements.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML fragment to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlExtractFragmentFunc struct{}
+
+func (*HtmlExtractFragmentFunc) Deterministic() bool { return true }
+func (*HtmlExtractFragmentFunc) Args() int           { return 2 }
+func (*HtmlExtractFragmentFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	var source string
+	var err error
+	if handle, ok := values[0].Pointer().(*HtmlDocument); ok {
+		source = handle.Source
+	} else if source, err = documentSource(values[0]); err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	doc, err := parseHtmlFragment(source)
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	sub, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_extract_between(document, start_selector, end_selector)
+ * Returns the HTML of the siblings that follow the first element in document matching start_selector,
+ * up to but not including the first of them that matches end_selector, or up to the end of their
+ * parent if none does. Text and comments between the elements are included.
+ * Returns NULL if no element matches start_selector.
+ * Raises an error if document is not proper HTML, or if end_selector is invalid.
+ * @param document {text | html} - HTML document to read from.
+ * @param start_selector {text} - CSS-style selector of the element to start after.
+ * @param end_selector {text} - CSS-style selector of the sibling element to stop at.
+ */
+type HtmlExtractBetweenFunc struct{}
+
+func (*HtmlExtractBetweenFunc) Deterministic() bool { return true }
+func (*HtmlExtractBetweenFunc) Args() int           { return 3 }
+func (*HtmlExtractBetweenFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	startSelector := values[1].Text()
+
+	end, err := selectorMatcher(values[2].Text())
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	start, err := findFirst(doc.Selection, startSelector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if start.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	var buf strings.Builder
+	for n := start.Get(0).NextSibling; n != nil; n = n.NextSibling {
+		if n.Type == html.ElementNode && end.Match(n) {
+			break
+		}
+		if err := html.Render(&buf, n); err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+
+	c.ResultText(buf.String())
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_extract_first(document, selector1, selector2, ...)
+ * Tries each selector in order, and returns the HTML of the first element in document matching
+ * the first selector that matches anything, or NULL if none of them match.
+ * Raises an error if document is not proper HTML, or if a selector tried before a match is invalid.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selectors of which element in document to extract, in order of preference.
+ */
+type HtmlExtractFirstFunc struct{}
+
+func (*HtmlExtractFirstFunc) Deterministic() bool { return true }
+func (*HtmlExtractFirstFunc) Args() int           { return -1 }
+func (*HtmlExtractFirstFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	if len(values) < 2 {
+		c.ResultError(errors.New("html_extract_first requires a document and at least one selector"))
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	for _, value := range values[1:] {
+		match, err := findFirst(doc.Selection, value.Text())
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		if match.Length() == 0 {
+			continue
+		}
+
+		sub, err := goquery.OuterHtml(match)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+
+		c.ResultText(sub)
+		c.ResultSubType(HTML_SUBTYPE)
+		return
+	}
+
+	c.ResultNull()
+}
+
+/** html_tag(document, selector)
+ * Returns the lowercase tag name of the first element in document matching selector,
+ * or NULL if no element matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlTagFunc struct{}
+
+func (*HtmlTagFunc) Deterministic() bool { return true }
+func (*HtmlTagFunc) Args() int           { return 2 }
+func (*HtmlTagFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	c.ResultText(goquery.NodeName(match))
+}
+
+// nthMatch returns the 1-based nth element of s, counting from the end when n is negative.
+func nthMatch(s *goquery.Selection, n int) *goquery.Selection {
+	if n > 0 {
+		return s.Eq(n - 1)
+	}
+	if n < 0 {
+		return s.Eq(n)
+	}
+	return s.Slice(0, 0)
+}
+
+/** html_nth(document, selector, n)
+ * Returns the entire HTML representation of the nth element matching selector in document.
+ * n is 1-based, and negative values count from the end (-1 is the last match).
+ * Returns NULL if n is out of range.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ * @param n {integer} - Position of the match to return.
+ */
+type HtmlNthFunc struct{}
+
+func (*HtmlNthFunc) Deterministic() bool { return true }
+func (*HtmlNthFunc) Args() int           { return 3 }
+func (*HtmlNthFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	n := values[2].Int()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	match := nthMatch(matches, n)
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	sub, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_matches(document, selector)
+ * Returns 1 if any element in document matches selector, 0 otherwise.
+ * Stops at the first match, so it's cheaper than html_count for existence checks.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector to match elements in document.
+ */
+type HtmlMatchesFunc struct{}
+
+func (*HtmlMatchesFunc) Deterministic() bool { return true }
+func (*HtmlMatchesFunc) Args() int           { return 2 }
+func (*HtmlMatchesFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() > 0 {
+		c.ResultInt(1)
+	} else {
+		c.ResultInt(0)
+	}
+}
+
+/** html_closest(document, selector, ancestor_selector)
+ * Finds the first element in document matching selector, then returns the entire HTML representation
+ * of the closest element matching ancestor_selector, starting with the element itself and walking up
+ * through its ancestors. Like the DOM's .closest().
+ * Returns NULL if either element is not found.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to start from.
+ * @param ancestor_selector {text} - CSS-style selector of which ancestor element to return.
+ */
+type HtmlClosestFunc struct{}
+
+func (*HtmlClosestFunc) Deterministic() bool { return true }
+func (*HtmlClosestFunc) Args() int           { return 3 }
+func (*HtmlClosestFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	ancestorMatcher, err := selectorMatcher(values[2].Text())
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	ancestor := match.ClosestMatcher(ancestorMatcher)
+	if ancestor.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	sub, err := goquery.OuterHtml(ancestor)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+// compilePattern compiles a regular expression, with flags given as a string
+// of Go's inline flag letters, like "i" for case-insensitive matching.
+func compilePattern(pattern, flags string) (*regexp.Regexp, error) {
+	for _, flag := range flags {
+		if !strings.ContainsRune("imsU", flag) {
+			return nil, fmt.Errorf("unknown regexp flag %q, expected one of i, m, s, or U", flag)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+/** html_find_text(document, tag, pattern [, flags])
+ * Returns the entire HTML representation of the first element in document matching tag
+ * whose text matches the regular expression pattern.
+ * Returns NULL if no element matches.
+ * Raises an error if document is not proper HTML, or if pattern or flags are invalid.
+ * @param document {text | html} - HTML document to read from.
+ * @param tag {text} - CSS-style selector of which elements in document to search, usually a tag name.
+ * @param pattern {text} - Regular expression that the element's text must match.
+ * @param flags {text} - Regular expression flags, like "i" for case-insensitive matching.
+ */
+type HtmlFindTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlFindTextFunc) Deterministic() bool { return true }
+func (h *HtmlFindTextFunc) Args() int         { return h.nArgs }
+func (*HtmlFindTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	flags := ""
+	if len(values) > 3 {
+		flags = values[3].Text()
+	}
+
+	re, err := compilePattern(values[2].Text(), flags)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	match := matches.FilterFunction(func(i int, s *goquery.Selection) bool {
+		return re.MatchString(s.Text())
+	}).First()
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	sub, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_find_attr_regex(document, tag, attribute, pattern [, flags])
+ * Returns the entire HTML representation of the first element in document matching tag
+ * whose attribute value matches the regular expression pattern.
+ * Returns NULL if no element matches.
+ * Raises an error if document is not proper HTML, or if pattern or flags are invalid.
+ * @param document {text | html} - HTML document to read from.
+ * @param tag {text} - CSS-style selector of which elements in document to search, usually a tag name.
+ * @param attribute {text} - Name of the attribute to match.
+ * @param pattern {text} - Regular expression that the attribute's value must match.
+ * @param flags {text} - Regular expression flags, like "i" for case-insensitive matching.
+ */
+type HtmlFindAttrRegexFunc struct {
+	nArgs int
+}
+
+func (*HtmlFindAttrRegexFunc) Deterministic() bool { return true }
+func (h *HtmlFindAttrRegexFunc) Args() int         { return h.nArgs }
+func (*HtmlFindAttrRegexFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	attribute := values[2].Text()
+	flags := ""
+	if len(values) > 4 {
+		flags = values[4].Text()
+	}
+
+	re, err := compilePattern(values[3].Text(), flags)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	match := matches.FilterFunction(func(i int, s *goquery.Selection) bool {
+		value, ok := s.Attr(attribute)
+		return ok && re.MatchString(value)
+	}).First()
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	sub, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(sub)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_count(document, selector)
+ * Count the number of matching selected elements in the given document.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlCountFunc struct{}
+
+func (*HtmlCountFunc) Deterministic() bool { return true }
+func (*HtmlCountFunc) Args() int           { return 2 }
+func (*HtmlCountFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	count := matches.Length()
+
+	c.ResultInt(count)
+}
+
+/** html_count_agg(document, selector)
+ * An aggregate function that sums the number of elements matching selector in every document
+ * of the group, like sum(html_count(document, selector)), but only compiles selector again when it
+ * changes between rows. NULL documents are skipped, and an empty group counts 0.
+ * Raises an error if a document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to count.
+ */
+type HtmlCountAggFunc struct{}
+
+func (*HtmlCountAggFunc) Args() int           { return 2 }
+func (*HtmlCountAggFunc) Deterministic() bool { return true }
+
+type HtmlCountAggContext struct {
+	selector string
+	matcher  goquery.Matcher
+	count    int
+}
+
+func (*HtmlCountAggFunc) Step(ctx *sqlite.AggregateContext, values ...sqlite.Value) {
+	if ctx.Data() == nil {
+		ctx.SetData(&HtmlCountAggContext{})
+	}
+
+	var aCtx = ctx.Data().(*HtmlCountAggContext)
+	if values[0].Type() == sqlite.SQLITE_NULL {
+		return
+	}
+
+	if selector := values[1].Text(); aCtx.matcher == nil || selector != aCtx.selector {
+		matcher, err := selectorMatcher(selector)
+		if err != nil {
+			ctx.ResultError(err)
+			return
+		}
+		aCtx.selector, aCtx.matcher = selector, matcher
+	}
+
+	doc, err := documentArg(values[0])
+	if err != nil {
+		ctx.ResultError(err)
+		return
+	}
+
+	aCtx.count += doc.FindMatcher(aCtx.matcher).Length()
+}
+
+func (*HtmlCountAggFunc) Final(ctx *sqlite.AggregateContext) {
+	if ctx.Data() == nil {
+		ctx.ResultInt(0)
+		return
+	}
+	ctx.ResultInt(ctx.Data().(*HtmlCountAggContext).count)
+}
+
+/** html_count_distinct_text(document, selector)
+ * Count the number of distinct text values among the elements matching selector in document.
+ * Whitespace in each element's text is collapsed and trimmed before comparing.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ */
+type HtmlCountDistinctTextFunc struct{}
+
+func (*HtmlCountDistinctTextFunc) Deterministic() bool { return true }
+func (*HtmlCountDistinctTextFunc) Args() int           { return 2 }
+func (*HtmlCountDistinctTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	texts := map[string]bool{}
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Each(func(i int, s *goquery.Selection) {
+		texts[strings.Join(strings.Fields(s.Text()), " ")] = true
+	})
+
+	c.ResultInt(len(texts))
+}
+
+// maxDepth returns the number of elements on the longest path down from n, counting n itself.
+func maxDepth(n *html.Node) int {
+	depth := 0
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if d := maxDepth(child); d > depth {
+			depth = d
+		}
+	}
+	if n.Type == html.ElementNode {
+		depth++
+	}
+	return depth
+}
+
+/** html_depth(document [, selector])
+ * Returns the maximum element nesting depth of document, or of the first element matching selector.
+ * The matched element itself is depth 1, while a whole document includes its <html> and <body> elements.
+ * Returns NULL if no element matches selector.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to measure.
+ */
+type HtmlDepthFunc struct {
+	nArgs int
+}
+
+func (*HtmlDepthFunc) Deterministic() bool { return true }
+func (h *HtmlDepthFunc) Args() int         { return h.nArgs }
+func (*HtmlDepthFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	root := doc.Get(0)
+	if len(values) > 1 {
+		match, err := findFirst(doc.Selection, values[1].Text())
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		if match.Length() == 0 {
+			c.ResultNull()
+			return
+		}
+		root = match.Get(0)
+	}
+
+	c.ResultInt(maxDepth(root))
+}
+
+// nodeAttr returns the value of node's key attribute, and whether it has one.
+func nodeAttr(node *html.Node, key string) (string, bool) {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// attribMap returns the attributes of node as a map, with values exactly as parsed.
+// Namespaced attributes like xlink:href keep their prefix.
+func attribMap(node *html.Node) map[string]string {
+	attrib := map[string]string{}
+	for _, attr := range node.Attr {
+		key := attr.Key
+		if attr.Namespace != "" {
+			key = attr.Namespace + ":" + key
+		}
+		attrib[key] = attr.Val
+	}
+	return attrib
+}
+
+type htmlEachJsonElement struct {
+	Tag    string            `json:"tag"`
+	Text   string            `json:"text"`
+	Class  *string           `json:"class"`
+	Attrib map[string]string `json:"attrib"`
+}
+
+/** html_each_json(document, selector)
+ * Returns a JSON array with an object for every matching element inside document using selector,
+ * with "tag", "text", "class", and "attrib" keys. "attrib" is a nested JSON object of the element's attributes.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ */
+type HtmlEachJsonFunc struct{}
+
+func (*HtmlEachJsonFunc) Deterministic() bool { return true }
+func (*HtmlEachJsonFunc) Args() int           { return 2 }
+func (*HtmlEachJsonFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	elements := []htmlEachJsonElement{}
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	matches.Each(func(i int, s *goquery.Selection) {
+		element := htmlEachJsonElement{
+			Tag:    goquery.NodeName(s),
+			Text:   s.Text(),
+			Attrib: attribMap(s.Get(0)),
+		}
+		if class, ok := s.Attr("class"); ok {
+			element.Class = &class
+		}
+		elements = append(elements, element)
+	})
+
+	result, err := json.Marshal(elements)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(string(result))
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+type htmlExtractJsonElement struct {
+	Tag    string            `json:"tag"`
+	Text   string            `json:"text"`
+	Html   string            `json:"html"`
+	Attrib map[string]string `json:"attrib"`
+}
+
+/** html_extract_json(document, selector)
+ * Returns a JSON object describing the first element in document matching selector,
+ * with "tag", "text", "html", and "attrib" keys. "attrib" is a nested JSON object of the element's attributes.
+ * Returns NULL if no element matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlExtractJsonFunc struct{}
+
+func (*HtmlExtractJsonFunc) Deterministic() bool { return true }
+func (*HtmlExtractJsonFunc) Args() int           { return 2 }
+func (*HtmlExtractJsonFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	html, err := goquery.OuterHtml(match)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// keep the markup in "html" readable, instead of escaping every < and > as \u003c and \u003e
+	var result strings.Builder
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(htmlExtractJsonElement{
+		Tag:    goquery.NodeName(match),
+		Text:   match.Text(),
+		Html:   html,
+		Attrib: attribMap(match.Get(0)),
+	})
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(strings.TrimSuffix(result.String(), "\n"))
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+/** html_outer_all(document, selector)
+ * Returns a JSON array of the HTML of every element in document matching selector, in document order.
+ * Returns an empty array if nothing matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ */
+type HtmlOuterAllFunc struct{}
+
+func (*HtmlOuterAllFunc) Deterministic() bool { return true }
+func (*HtmlOuterAllFunc) Args() int           { return 2 }
+func (*HtmlOuterAllFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	outers := make([]string, matches.Length())
+	for i := range matches.Nodes {
+		if outers[i], err = goquery.OuterHtml(matches.Eq(i)); err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+
+	// keep the markup readable, instead of escaping every < and > as \u003c and \u003e
+	var result strings.Builder
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	if err = encoder.Encode(outers); err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(strings.TrimSuffix(result.String(), "\n"))
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+// pluckAttribute matches the "@name" suffix of a html_pluck selector. Quotes and brackets can't
+// be part of it, so an "@" in the value of an attribute selector isn't mistaken for one.
+var pluckAttribute = regexp.MustCompile(`^(.*)@([^\s"'<>/=\[\]()@]+)$`)
+
+// pluckValue returns the value html_pluck extracts with spec from the first element in s matching
+// its selector: the element's text, its HTML with "@html", or the value of an attribute with "@name".
+// The second result is false if nothing matches, or if the element doesn't have the attribute.
+func pluckValue(s *goquery.Selection, spec string) (string, bool, error) {
+	selector, mode := spec, "text"
+	if m := pluckAttribute.FindStringSubmatch(spec); m != nil {
+		selector, mode = m[1], m[2]
+	}
+
+	match, err := findFirst(s, selector)
+	if err != nil || match.Length() == 0 {
+		return "", false, err
+	}
+
+	switch mode {
+	case "text":
+		return match.Text(), true, nil
+	case "html":
+		outer, err := goquery.OuterHtml(match)
+		return outer, err == nil, err
+	}
+	value, ok := match.Attr(mode)
+	return value, ok, nil
+}
+
+// jsonText encodes s as a JSON string, leaving <, >, and & readable instead of escaping them.
+func jsonText(s string) (string, error) {
+	var result strings.Builder
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(result.String(), "\n"), nil
+}
+
+/** html_pluck(document, mapping)
+ * Returns a JSON object with a value for every key in mapping, a JSON object mapping keys to selectors.
+ * Each value is the text of the first element in document matching the key's selector, or with a
+ * "@name" suffix, the value of its name attribute, or with "@html", its HTML. Values are null when
+ * nothing matches. The document is only parsed once, and keys keep their order from mapping.
+ * Raises an error if document is not proper HTML, or if mapping isn't a JSON object of strings.
+ * @param document {text | html} - HTML document to read from.
+ * @param mapping {text} - JSON object mapping output keys to CSS-style selectors.
+ */
+type HtmlPluckFunc struct{}
+
+func (*HtmlPluckFunc) Deterministic() bool { return true }
+func (*HtmlPluckFunc) Args() int           { return 2 }
+func (*HtmlPluckFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	// read mapping token by token, since decoding it into a map would lose the order of its keys
+	var keys, specs []string
+	index := map[string]int{}
+	decoder := json.NewDecoder(strings.NewReader(values[1].Text()))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		c.ResultError(fmt.Errorf("mapping must be a JSON object of keys to selectors"))
+		return
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			c.ResultError(fmt.Errorf("mapping must be a JSON object of keys to selectors: %w", err))
+			return
+		}
+		key := token.(string)
+		var spec string
+		if err := decoder.Decode(&spec); err != nil {
+			c.ResultError(fmt.Errorf("mapping: selector for %q must be a string", key))
+			return
+		}
+		// like in JSON objects, a repeated key replaces the earlier one
+		if i, ok := index[key]; ok {
+			specs[i] = spec
+			continue
+		}
+		index[key] = len(keys)
+		keys = append(keys, key)
+		specs = append(specs, spec)
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// the object is written by hand to keep the order of the keys, like in html_table_to_json
+	var buf strings.Builder
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := jsonText(key)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		buf.WriteString(k)
+		buf.WriteByte(':')
+
+		value, ok, err := pluckValue(doc.Selection, specs[i])
+		if err != nil {
+			c.ResultError(fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		if !ok {
+			buf.WriteString("null")
+			continue
+		}
+		v, err := jsonText(value)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		buf.WriteString(v)
+	}
+	buf.WriteByte('}')
+
+	c.ResultText(buf.String())
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+// byteCounter is an io.Writer that only counts the bytes written to it.
+type byteCounter int
+
+func (b *byteCounter) Write(p []byte) (int, error) {
+	*b += byteCounter(len(p))
+	return len(p), nil
+}
+
+// renderedSize returns the length in bytes of the HTML of n, without holding onto it.
+func renderedSize(n *html.Node) (int, error) {
+	var size byteCounter
+	if err := html.Render(&size, n); err != nil {
+		return 0, err
+	}
+	return int(size), nil
+}
+
+/** html_size(document [, selector])
+ * Returns the length in bytes of the HTML of the first element in document matching selector,
+ * or of the whole serialized document without one. Returns NULL if no element matches.
  * Raises an error if document is not proper HTML.
  * @param document {text | html} - HTML document to read from.
- * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param selector {text} - CSS-style selector of which element in document to measure.
  */
-type HtmlExtractFunc struct{}
-
-func (*HtmlExtractFunc) Deterministic() bool { return true }
-func (*HtmlExtractFunc) Args() int           { return 2 }
-func (*HtmlExtractFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	html := values[0].Text()
-	selector := values[1].Text()
+type HtmlSizeFunc struct {
+	nArgs int
+}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+func (*HtmlSizeFunc) Deterministic() bool { return true }
+func (h *HtmlSizeFunc) Args() int         { return h.nArgs }
+func (*HtmlSizeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
 
 	if err != nil {
 		c.ResultError(err)
 		return
 	}
 
-	sub, err := goquery.OuterHtml(doc.FindMatcher(goquery.Single(selector)))
+	match := doc.Selection
+	if len(values) > 1 {
+		if match, err = findFirst(doc.Selection, values[1].Text()); err != nil {
+			c.ResultError(err)
+			return
+		}
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	size, err := renderedSize(match.Get(0))
 	if err != nil {
 		c.ResultError(err)
 		return
 	}
 
-	c.ResultText(sub)
-	c.ResultSubType(HTML_SUBTYPE)
+	c.ResultInt(size)
 }
 
-/** html_count(document, selector)
- * Count the number of matching selected elements in the given document.
+/** html_offset(document, selector)
+ * Returns the 0-based byte offset of the start tag of the first element in document matching selector,
+ * within the source of document. Returns NULL if no element matches, or if the first match was created
+ * by the parser and has no start tag in the source.
  * Raises an error if document is not proper HTML.
  * @param document {text | html} - HTML document to read from.
- * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param selector {text} - CSS-style selector of which element in document to locate.
  */
-type HtmlCountFunc struct{}
+type HtmlOffsetFunc struct{}
 
-func (*HtmlCountFunc) Deterministic() bool { return true }
-func (*HtmlCountFunc) Args() int           { return 2 }
-func (*HtmlCountFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	html := values[0].Text()
+func (*HtmlOffsetFunc) Deterministic() bool { return true }
+func (*HtmlOffsetFunc) Args() int           { return 2 }
+func (*HtmlOffsetFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
 	selector := values[1].Text()
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	doc, err := documentArg(values[0])
 
 	if err != nil {
 		c.ResultError(err)
 		return
 	}
 
-	count := doc.Find(selector).Length()
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
 
-	c.ResultInt(count)
+	offsets := sourceOffsets(doc.Source, doc.Get(0))
+	if offset, ok := offsets[match.Get(0)]; ok {
+		c.ResultInt(offset)
+	} else {
+		c.ResultNull()
+	}
 }
 
-/** html_each(document, selector)
+/** html_each(document, selector [, root_inclusive [, max_rows [, context [, attr_name [, path_root]]]]])
  * A table value function returned a row for every matching element inside document using selector.
+ * With max_rows, only the first max_rows elements matching selector are returned, before any other constraints.
+ * With context, only elements inside the elements matching context are returned.
+ * With context and root_inclusive, the context elements themselves are returned too if they match selector.
+ * With attr_name, the attr_value column contains the value of that attribute on each element.
+ * With path_root, the unique_css column starts from the nearest ancestor matching path_root.
  * Raises an error if document is not proper HTML.
  * @param document {text | html} - HTML document to read from.
  * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param root_inclusive {integer} - Whether to include matching context elements, defaults to 0. Without context,
+ * html_each searches from the document node, so top-level elements are always included.
+ * @param max_rows {integer} - Maximum number of rows to return, a NULL or negative value returns every row.
+ * @param context {text} - CSS-style selector of which elements in document to search inside, defaults to the whole document.
+ * @param attr_name {text} - Name of the attribute to read into the attr_value column.
+ * @param path_root {text} - CSS-style selector of the ancestors that unique_css is relative to.
  */
  var HtmlEachColumns = []vtab.Column{
 	{Name: "document", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
 	{Name: "selector", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+	{Name: "root_inclusive", Type: sqlite.SQLITE_INTEGER.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "max_rows", Type: sqlite.SQLITE_INTEGER.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "context", Type: sqlite.SQLITE_TEXT.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "attr_name", Type: sqlite.SQLITE_TEXT.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+	{Name: "path_root", Type: sqlite.SQLITE_TEXT.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
 
 	{Name: "html", Type: sqlite.SQLITE_TEXT.String()},
 	{Name: "text", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "value", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "child_count", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "line", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "is_visible", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "attrib_count", Type: sqlite.SQLITE_INTEGER.String(), Filters: []*vtab.ColumnFilter{
+		{Op: sqlite.INDEX_CONSTRAINT_EQ}, {Op: sqlite.INDEX_CONSTRAINT_GT}, {Op: sqlite.INDEX_CONSTRAINT_GE},
+	}},
+	{Name: "tag", Type: sqlite.SQLITE_TEXT.String(), Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ}}},
+	{Name: "text_norm", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "is_void", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "qname", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "signature", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "own_text", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "unique_css", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "attr_value", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "byte_size", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "match_index", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "checked", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "disabled", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "selected", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "hidden", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "required", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "is_foreign", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "ancestor_classes", Type: sqlite.SQLITE_TEXT.String()},
+}
+
+// Elements that never have children, so their start tags are never followed by an end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "keygen": true, "link": true, "meta": true, "param": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+// qualifiedName returns the tag name of n, prefixed with the namespace the parser put it in,
+// like "svg:rect" for a <rect> inside an <svg>. Prefixes written in the source, like <og:image>,
+// are already part of the tag name.
+func qualifiedName(n *html.Node) string {
+	if n.Namespace == "" || strings.Contains(n.Data, ":") {
+		return n.Data
+	}
+	return n.Namespace + ":" + n.Data
+}
+
+// nodeSignature returns a short CSS-like description of n: its tag name followed by
+// its id, like "div#main", or by its classes if it has no id, like "li.item.active".
+func nodeSignature(n *html.Node) string {
+	if id, ok := nodeAttr(n, "id"); ok && id != "" {
+		return n.Data + "#" + id
+	}
+	signature := n.Data
+	if class, ok := nodeAttr(n, "class"); ok {
+		for _, name := range strings.Fields(class) {
+			signature += "." + name
+		}
+	}
+	return signature
+}
+
+// uniqueSelector returns a CSS selector that matches n and nothing else in its document:
+// the position of n and of each of its ancestors below the root element, like
+// "html > body:nth-child(2) > ul:nth-child(1) > li:nth-child(3)".
+// If root isn't nil, the selector stops at the nearest ancestor of n that matches root,
+// and starts with that ancestor's tag name instead of its position, like "ul > li:nth-child(3)".
+func uniqueSelector(n *html.Node, root goquery.Matcher) string {
+	var steps []string
+	for ; n.Parent != nil && n.Parent.Type == html.ElementNode; n = n.Parent {
+		if root != nil && len(steps) > 0 && root.Match(n) {
+			break
+		}
+		position := 1
+		for sibling := n.PrevSibling; sibling != nil; sibling = sibling.PrevSibling {
+			if sibling.Type == html.ElementNode {
+				position++
+			}
+		}
+		// selectors match tag names in lowercase, so mixed-case SVG elements like
+		// <linearGradient> only match by position
+		tag := n.Data
+		if !tagNamePattern.MatchString(tag) || tag != strings.ToLower(tag) {
+			tag = "*"
+		}
+		steps = append(steps, fmt.Sprintf("%s:nth-child(%d)", tag, position))
+	}
+	if tag := n.Data; tagNamePattern.MatchString(tag) && tag == strings.ToLower(tag) {
+		steps = append(steps, tag)
+	} else {
+		steps = append(steps, "*")
+	}
+
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return strings.Join(steps, " > ")
+}
+
+// ancestorClasses returns the classes of every element from the root element down to n,
+// root first and ending with n itself. Elements without classes have an empty list.
+func ancestorClasses(n *html.Node) [][]string {
+	var chain [][]string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		classes := []string{}
+		if class, ok := nodeAttr(n, "class"); ok {
+			classes = strings.Fields(class)
+		}
+		chain = append(chain, classes)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// formValue returns the current value of the form control in s, and whether it has one.
+// Inputs use their value attribute, though checkboxes and radios only have a value when checked.
+// Textareas use their text, and selects use the value of their selected (or first) option.
+func formValue(s *goquery.Selection) (string, bool) {
+	switch goquery.NodeName(s) {
+	case "input":
+		switch strings.ToLower(s.AttrOr("type", "")) {
+		case "checkbox", "radio":
+			if _, checked := s.Attr("checked"); !checked {
+				return "", false
+			}
+			// "on" is the default value of checkboxes and radios without one
+			return s.AttrOr("value", "on"), true
+		}
+		return s.Attr("value")
+	case "textarea":
+		return s.Text(), true
+	case "select":
+		option := s.Find("option[selected]").First()
+		if option.Length() == 0 {
+			option = s.Find("option").First()
+		}
+		if option.Length() == 0 {
+			return "", false
+		}
+		if value, ok := option.Attr("value"); ok {
+			return value, true
+		}
+		return strings.Join(strings.Fields(option.Text()), " "), true
+	}
+	return "", false
+}
+
+// hiddenStyle reports whether an inline style attribute hides its element,
+// with a display:none or visibility:hidden declaration.
+func hiddenStyle(style string) bool {
+	for _, declaration := range strings.Split(style, ";") {
+		parts := strings.SplitN(declaration, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		property := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(parts[1]), "!important")))
+		if (property == "display" && value == "none") || (property == "visibility" && value == "hidden") {
+			return true
+		}
+	}
+	return false
+}
+
+// isVisible guesses whether node would be rendered, by checking node and its ancestors
+// for the hidden attribute, hidden inline styles, hidden inputs, and elements that
+// are never rendered like <head> or <template>. Stylesheets are not applied.
+func isVisible(node *html.Node) bool {
+	for n := node; n != nil; n = n.Parent {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.Data {
+		case "head", "script", "style", "template":
+			return false
+		}
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "hidden":
+				return false
+			case "style":
+				if hiddenStyle(attr.Val) {
+					return false
+				}
+			case "type":
+				if n.Data == "input" && strings.EqualFold(strings.TrimSpace(attr.Val), "hidden") {
+					return false
+				}
+			}
+		}
+	}
+	return true
 }
 
  type HtmlEachCursor struct {
 	current int
 
+	source   string
 	document *goquery.Document
 	children *goquery.Selection
+
+	// the attribute read by the attr_value column, from the attr_name argument
+	attrName string
+	// the ancestors that the unique_css column is relative to, from the path_root argument
+	pathRoot goquery.Matcher
+
+	// start tag offsets into source, only computed if the line column is used
+	offsets map[*html.Node]int
+	// the position of each child among all the matches, before filterHtmlEach narrowed them down
+	matchIndexes map[*html.Node]int
 }
 
 func (cur *HtmlEachCursor) Column(ctx *sqlite.Context, c int) error {
+	if c < 0 || c >= len(HtmlEachColumns) {
+		return fmt.Errorf("html_each: column index %d out of range", c)
+	}
 
 	col := HtmlEachColumns[c].Name
 	switch col {
@@ -123,17 +1390,114 @@ func (cur *HtmlEachCursor) Column(ctx *sqlite.Context, c int) error {
 		ctx.ResultText("")
 	case "selector":
 		ctx.ResultText("")
+	case "root_inclusive":
+		ctx.ResultInt(0)
+	case "max_rows":
+		ctx.ResultNull()
+	case "context":
+		ctx.ResultNull()
+	case "attr_name":
+		ctx.ResultText(cur.attrName)
+	case "path_root":
+		ctx.ResultNull()
 
 	case "html":
 		html, err := goquery.OuterHtml(cur.children.Eq(cur.current))
 		if err != nil {
-			ctx.ResultError(err)
-		} else {
-			ctx.ResultText(html)
-			ctx.ResultSubType(HTML_SUBTYPE)
+			return err
 		}
+		ctx.ResultText(html)
+		ctx.ResultSubType(HTML_SUBTYPE)
 	case "text":
 		ctx.ResultText(cur.children.Eq(cur.current).Text())
+	case "value":
+		if value, ok := formValue(cur.children.Eq(cur.current)); ok {
+			ctx.ResultText(value)
+		} else {
+			ctx.ResultNull()
+		}
+	case "child_count":
+		ctx.ResultInt(cur.children.Eq(cur.current).Children().Length())
+	case "line":
+		if cur.offsets == nil {
+			cur.offsets = sourceOffsets(cur.source, cur.document.Get(0))
+		}
+		if offset, ok := cur.offsets[cur.children.Get(cur.current)]; ok {
+			ctx.ResultInt(sourceLine(cur.source, offset))
+		} else {
+			ctx.ResultNull()
+		}
+	case "is_visible":
+		if isVisible(cur.children.Get(cur.current)) {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "attrib_count":
+		ctx.ResultInt(len(cur.children.Get(cur.current).Attr))
+	case "tag":
+		ctx.ResultText(goquery.NodeName(cur.children.Eq(cur.current)))
+	case "text_norm":
+		ctx.ResultText(strings.Join(strings.Fields(cur.children.Eq(cur.current).Text()), " "))
+	case "is_void":
+		// <svg> and <math> elements like <image/> can self-close, but aren't void
+		node := cur.children.Get(cur.current)
+		if node.Namespace == "" && voidElements[node.Data] {
+			ctx.ResultInt(1)
+		} else {
+			ctx.ResultInt(0)
+		}
+	case "qname":
+		ctx.ResultText(qualifiedName(cur.children.Get(cur.current)))
+	case "signature":
+		ctx.ResultText(nodeSignature(cur.children.Get(cur.current)))
+	case "own_text":
+		var buf strings.Builder
+		for child := cur.children.Get(cur.current).FirstChild; child != nil; child = child.NextSibling {
+			if child.Type == html.TextNode {
+				buf.WriteString(child.Data)
+			}
+		}
+		ctx.ResultText(buf.String())
+	case "unique_css":
+		ctx.ResultText(uniqueSelector(cur.children.Get(cur.current), cur.pathRoot))
+	case "attr_value":
+		if value, ok := cur.children.Eq(cur.current).Attr(cur.attrName); ok && cur.attrName != "" {
+			ctx.ResultText(value)
+		} else {
+			ctx.ResultNull()
+		}
+	case "byte_size":
+		// only rendered when asked for, and never held onto
+		size, err := renderedSize(cur.children.Get(cur.current))
+		if err != nil {
+			return err
+		}
+		ctx.ResultInt(size)
+	case "match_index":
+		ctx.ResultInt(cur.matchIndexes[cur.children.Get(cur.current)])
+	case "checked", "disabled", "selected", "hidden", "required":
+		// boolean attributes are set by being present, whatever their value
+		resultFlag(ctx, cur.children.Eq(cur.current), col)
+	case "is_foreign":
+		// the parser puts everything inside <svg> and <math> in their namespaces,
+		// until an HTML integration point like <foreignObject>
+		switch cur.children.Get(cur.current).Namespace {
+		case "svg", "math":
+			ctx.ResultInt(1)
+		default:
+			ctx.ResultInt(0)
+		}
+	case "ancestor_classes":
+		result, err := json.Marshal(ancestorClasses(cur.children.Get(cur.current)))
+		if err != nil {
+			return err
+		}
+		ctx.ResultText(string(result))
+		ctx.ResultSubType(JSON_SUBTYPE)
+	default:
+		// every column in HtmlEachColumns needs a case above
+		return fmt.Errorf("html_each: unknown column %q", col)
 	}
 	return nil
 }
@@ -146,39 +1510,316 @@ func (cur *HtmlEachCursor) Next() (vtab.Row, error) {
 	return cur, nil
 }
 
-func HtmlEachIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
-	document := ""
-	selector := ""
-
+// htmlEachArgs reads the document and selector arguments of html_each-style table functions.
+func htmlEachArgs(constraints []*vtab.Constraint) (document sqlite.Value, selector string) {
 	for _, constraint := range constraints {
 		if constraint.Op == sqlite.INDEX_CONSTRAINT_EQ {
 			switch constraint.ColIndex {
 			case 0:
-				document = constraint.Value.Text()
+				document = *constraint.Value
 			case 1:
 				selector = constraint.Value.Text()
 			}
 		}
 	}
+	return document, selector
+}
+
+// compileSelector compiles a CSS selector, reporting invalid selectors as errors,
+// where goquery's Find() would silently match nothing.
+func compileSelector(selector string) (goquery.Matcher, error) {
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return compiled, nil
+}
+
+// selectorMatcher compiles a selector argument. Every function compiles its selectors
+// this way, so a selector matches the same elements everywhere.
+// Empty selectors match nothing, instead of being an error.
+func selectorMatcher(selector string) (goquery.Matcher, error) {
+	if strings.TrimSpace(selector) == "" {
+		return matchNothing{}, nil
+	}
+	return compileSelector(selector)
+}
+
+// findAll returns the descendants of s matching selector.
+func findAll(s *goquery.Selection, selector string) (*goquery.Selection, error) {
+	matcher, err := selectorMatcher(selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindMatcher(matcher), nil
+}
+
+// findFirst returns the first descendant of s matching selector, in document order.
+func findFirst(s *goquery.Selection, selector string) (*goquery.Selection, error) {
+	matcher, err := selectorMatcher(selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.FindMatcher(goquery.SingleMatcher(matcher)), nil
+}
+
+// matchNothing is a goquery.Matcher that never matches.
+type matchNothing struct{}
+
+func (matchNothing) Match(*html.Node) bool            { return false }
+func (matchNothing) MatchAll(*html.Node) []*html.Node { return nil }
+func (matchNothing) Filter([]*html.Node) []*html.Node { return nil }
+
+// htmlEachOption returns the value of the optional hidden argument of html_each named name, if it's given.
+func htmlEachOption(constraints []*vtab.Constraint, name string) (value sqlite.Value, ok bool) {
+	for _, constraint := range constraints {
+		if constraint.Op == sqlite.INDEX_CONSTRAINT_EQ && HtmlEachColumns[constraint.ColIndex].Name == name {
+			return *constraint.Value, true
+		}
+	}
+	return value, false
+}
+
+// htmlEachRootInclusive reports whether the optional root_inclusive argument of html_each is set.
+func htmlEachRootInclusive(constraints []*vtab.Constraint) bool {
+	value, ok := htmlEachOption(constraints, "root_inclusive")
+	return ok && value.Int() != 0
+}
+
+// htmlEachAttrName returns the optional attr_name argument of html_each, or "" if it isn't given.
+func htmlEachAttrName(constraints []*vtab.Constraint) string {
+	value, ok := htmlEachOption(constraints, "attr_name")
+	if !ok || value.Type() == sqlite.SQLITE_NULL {
+		return ""
+	}
+	return value.Text()
+}
+
+// htmlEachContext returns the elements in doc matching the optional context argument of html_each,
+// or nil if it isn't given.
+func htmlEachContext(doc *goquery.Document, constraints []*vtab.Constraint) (*goquery.Selection, error) {
+	value, ok := htmlEachOption(constraints, "context")
+	if !ok || value.Type() == sqlite.SQLITE_NULL {
+		return nil, nil
+	}
+	matcher, err := selectorMatcher(value.Text())
+	if err != nil {
+		return nil, fmt.Errorf("context: %w", err)
+	}
+	return doc.FindMatcher(matcher), nil
+}
+
+// htmlEachPathRoot compiles the optional path_root argument of html_each, or returns nil if it isn't given.
+func htmlEachPathRoot(constraints []*vtab.Constraint) (goquery.Matcher, error) {
+	value, ok := htmlEachOption(constraints, "path_root")
+	if !ok || value.Type() == sqlite.SQLITE_NULL {
+		return nil, nil
+	}
+	matcher, err := selectorMatcher(value.Text())
+	if err != nil {
+		return nil, fmt.Errorf("path_root: %w", err)
+	}
+	return matcher, nil
+}
+
+// limitHtmlEach keeps only the first children, if the optional max_rows argument of html_each is given.
+// A NULL or negative max_rows keeps every child, like a negative LIMIT. It's applied before filterHtmlEach,
+// since SQLite only sometimes passes the constraints it handles, and the rows shouldn't depend on the query plan.
+func limitHtmlEach(children *goquery.Selection, constraints []*vtab.Constraint) *goquery.Selection {
+	value, ok := htmlEachOption(constraints, "max_rows")
+	if !ok || value.Type() == sqlite.SQLITE_NULL || value.Int() < 0 || value.Int() >= children.Length() {
+		return children
+	}
+	return children.Slice(0, value.Int())
+}
+
+// matchIndexes maps each of matches to its 0-based position, for the match_index column.
+func matchIndexes(matches *goquery.Selection) map[*html.Node]int {
+	indexes := make(map[*html.Node]int, matches.Length())
+	for i, node := range matches.Nodes {
+		indexes[node] = i
+	}
+	return indexes
+}
+
+// filterHtmlEach narrows children down to the rows matching the optional constraints
+// on html_each's columns, so they're skipped before SQLite reads their other columns.
+func filterHtmlEach(children *goquery.Selection, constraints []*vtab.Constraint) *goquery.Selection {
+	for _, constraint := range constraints {
+		switch HtmlEachColumns[constraint.ColIndex].Name {
+		case "attrib_count":
+			// SQLite still double-checks these constraints, so other types can be left to it
+			if constraint.Value.Type() != sqlite.SQLITE_INTEGER {
+				continue
+			}
+			op, value := constraint.Op, constraint.Value.Int()
+			children = children.FilterFunction(func(i int, s *goquery.Selection) bool {
+				count := len(s.Get(0).Attr)
+				switch op {
+				case sqlite.INDEX_CONSTRAINT_EQ:
+					return count == value
+				case sqlite.INDEX_CONSTRAINT_GT:
+					return count > value
+				case sqlite.INDEX_CONSTRAINT_GE:
+					return count >= value
+				}
+				return true
+			})
+		case "tag":
+			if constraint.Value.Type() != sqlite.SQLITE_TEXT {
+				continue
+			}
+			tag := constraint.Value.Text()
+			children = children.FilterFunction(func(i int, s *goquery.Selection) bool {
+				return goquery.NodeName(s) == tag
+			})
+		}
+	}
+	return children
+}
+
+func HtmlEachIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, selector := htmlEachArgs(constraints)
+
+	matcher, err := selectorMatcher(selector)
+	if err != nil {
+		return nil, fmt.Errorf("html_each: %w", err)
+	}
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_each: failed to parse document: %w", err)
+	}
+
+	scope, err := htmlEachContext(doc.Document, constraints)
+	if err != nil {
+		return nil, fmt.Errorf("html_each: %w", err)
+	}
+
+	var matches *goquery.Selection
+	if scope == nil {
+		matches = doc.FindMatcher(matcher)
+	} else if htmlEachRootInclusive(constraints) {
+		// the context elements themselves can match too, in document order with their descendants
+		isContext := map[*html.Node]bool{}
+		for _, node := range scope.Nodes {
+			isContext[node] = true
+		}
+		matches = doc.Find("*").FilterFunction(func(i int, s *goquery.Selection) bool {
+			for node := s.Get(0); node != nil; node = node.Parent {
+				if isContext[node] {
+					return true
+				}
+			}
+			return false
+		}).FilterMatcher(matcher)
+	} else {
+		matches = scope.FindMatcher(matcher)
+	}
+	children := filterHtmlEach(limitHtmlEach(matches, constraints), constraints)
+	current := -1
+
+	pathRoot, err := htmlEachPathRoot(constraints)
+	if err != nil {
+		return nil, fmt.Errorf("html_each: %w", err)
+	}
+
+	return &HtmlEachCursor{
+		current:  current,
+		source:   doc.Source,
+		document: doc.Document,
+		children: children,
+		attrName: htmlEachAttrName(constraints),
+		pathRoot: pathRoot,
+
+		matchIndexes: matchIndexes(matches),
+	}, nil
+}
+
+/** html_children(document, selector [, root_inclusive [, max_rows [, context [, attr_name [, path_root]]]]])
+ * A table value function returning a row for every direct child of the top-level elements of document
+ * that matches selector, unlike html_each which matches all descendants. Has the same columns as html_each.
+ * With context, the children of the elements matching context are returned instead.
+ * With root_inclusive, the top-level (or context) elements themselves are returned too if they match selector.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which child elements in document to read.
+ * @param root_inclusive {integer} - Whether to include matching top-level elements, defaults to 0.
+ * @param max_rows {integer} - Maximum number of rows to return, like in html_each.
+ * @param context {text} - CSS-style selector of which elements' children to read, defaults to the top-level elements.
+ * @param attr_name {text} - Name of the attribute to read into the attr_value column, like in html_each.
+ * @param path_root {text} - CSS-style selector of the ancestors that unique_css is relative to, like in html_each.
+ */
+func HtmlChildrenIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, selector := htmlEachArgs(constraints)
+
+	matcher, err := selectorMatcher(selector)
+	if err != nil {
+		return nil, fmt.Errorf("html_children: %w", err)
+	}
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_children: failed to parse document: %w", err)
+	}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(document))
+	parents, err := htmlEachContext(doc.Document, constraints)
 	if err != nil {
-		return nil, sqlite.SQLITE_ABORT
+		return nil, fmt.Errorf("html_children: %w", err)
+	}
+	if parents == nil {
+		// goquery wraps everything in "<html><body>", so top-level elements are children of body
+		parents = doc.Find("body").Children()
 	}
 
-	children := doc.Find(selector)
+	children := parents.ChildrenMatcher(matcher)
+	if htmlEachRootInclusive(constraints) {
+		// the parents themselves can match too, ahead of their children
+		isParent := map[*html.Node]bool{}
+		for _, parent := range parents.Nodes {
+			isParent[parent] = true
+		}
+		children = doc.Find("*").FilterFunction(func(i int, s *goquery.Selection) bool {
+			node := s.Get(0)
+			return isParent[node] || isParent[node.Parent]
+		}).FilterMatcher(matcher)
+	}
+	matches := children
+	children = filterHtmlEach(limitHtmlEach(matches, constraints), constraints)
 	current := -1
 
+	pathRoot, err := htmlEachPathRoot(constraints)
+	if err != nil {
+		return nil, fmt.Errorf("html_children: %w", err)
+	}
+
 	return &HtmlEachCursor{
 		current:  current,
-		document: doc,
+		source:   doc.Source,
+		document: doc.Document,
 		children: children,
+		attrName: htmlEachAttrName(constraints),
+		pathRoot: pathRoot,
+
+		matchIndexes: matchIndexes(matches),
 	}, nil
 }
 
 func RegisterQuery(api *sqlite.ExtensionApi) error {
 	var err error
-	if err = api.CreateFunction("html_extract", &HtmlExtractFunc{}); err != nil {
+	if err = api.CreateFunction("html_extract", &HtmlExtractFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract", &HtmlExtractFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_fragment", &HtmlExtractFragmentFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_between", &HtmlExtractBetweenFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_first", &HtmlExtractFirstFunc{}); err != nil {
 		return err
 	}
 	if err = api.CreateFunction("html_text", &HtmlTextFunc{nArgs: 1}); err != nil {
@@ -187,11 +1828,71 @@ func RegisterQuery(api *sqlite.ExtensionApi) error {
 	if err = api.CreateFunction("html_text", &HtmlTextFunc{nArgs: 2}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_tag", &HtmlTagFunc{}); err != nil {
+		return err
+	}
 	if err = api.CreateFunction("html_count", &HtmlCountFunc{}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_count_agg", &HtmlCountAggFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_count_distinct_text", &HtmlCountDistinctTextFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_depth", &HtmlDepthFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_depth", &HtmlDepthFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_closest", &HtmlClosestFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_find_text", &HtmlFindTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_find_text", &HtmlFindTextFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_find_attr_regex", &HtmlFindAttrRegexFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_find_attr_regex", &HtmlFindAttrRegexFunc{nArgs: 5}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_matches", &HtmlMatchesFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_nth", &HtmlNthFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_each_json", &HtmlEachJsonFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_json", &HtmlExtractJsonFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_outer_all", &HtmlOuterAllFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_pluck", &HtmlPluckFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_size", &HtmlSizeFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_size", &HtmlSizeFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_offset", &HtmlOffsetFunc{}); err != nil {
+		return err
+	}
 	if err = api.CreateModule("html_each", vtab.NewTableFunc("html_each", HtmlEachColumns, HtmlEachIterator)); err != nil {
 		return err
 	}
+	if err = api.CreateModule("html_children", vtab.NewTableFunc("html_children", HtmlEachColumns, HtmlChildrenIterator)); err != nil {
+		return err
+	}
 	return nil
 }
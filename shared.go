@@ -16,6 +16,9 @@ func Register(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
 	if err := RegisterMeta(api); err != nil {
 		return sqlite.SQLITE_ERROR, err
 	}
+	if err := RegisterDocument(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
 	if err := RegisterAttrs(api); err != nil {
 		return sqlite.SQLITE_ERROR, err
 	}
@@ -25,9 +28,33 @@ func Register(api *sqlite.ExtensionApi) (sqlite.ErrorCode, error) {
 	if err := RegisterQuery(api); err != nil {
 		return sqlite.SQLITE_ERROR, err
 	}
+	if err := RegisterText(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterForms(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterAssets(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterTables(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
 	if err := RegisterUtils(api); err != nil {
 		return sqlite.SQLITE_ERROR, err
 	}
+	if err := RegisterModify(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterNormalize(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterUrls(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
+	if err := RegisterStream(api); err != nil {
+		return sqlite.SQLITE_ERROR, err
+	}
 	return sqlite.SQLITE_OK, nil
 }
 
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Pseudo-classes that depend on an element's contents or on its later siblings,
+// which a streaming pass hasn't seen yet when it reaches the element's start tag.
+var streamUnsupported = []string{
+	":has", ":contains", ":matches", ":empty", ":last-", ":only-", ":nth-last-",
+}
+
+// streamMatcher compiles selector for use in a streaming pass, rejecting
+// selectors that can't be decided from an element's start tag.
+func streamMatcher(selector string) (goquery.Matcher, error) {
+	lower := strings.ToLower(selector)
+	for _, pseudo := range streamUnsupported {
+		if strings.Contains(lower, pseudo) {
+			return nil, fmt.Errorf("selector %q uses %s, which can't be matched while streaming", selector, pseudo)
+		}
+	}
+	return selectorMatcher(selector)
+}
+
+// errNotStreamable is returned by streamCount for markup that the parser repairs
+// in ways a streaming pass doesn't repeat, so the document has to be parsed instead.
+var errNotStreamable = errors.New("document can't be counted while streaming")
+
+// Elements whose start tag closes an open <p>, like the parser does.
+var closesParagraph = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "center": true, "details": true,
+	"dialog": true, "dir": true, "div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "listing": true, "main": true, "menu": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true, "table": true, "ul": true,
+	"li": true, "dd": true, "dt": true, "xmp": true,
+}
+
+// Start tags that close an open element of the same kind, mapped to the
+// elements that stop the search for one.
+var closesSibling = map[string][]string{
+	"li":       {"ul", "ol", "menu", "dd", "dt", "td", "th", "caption"},
+	"dd":       {"dl", "li", "td", "th", "caption"},
+	"dt":       {"dl", "li", "td", "th", "caption"},
+	"option":   {"select"},
+	"optgroup": {"select"},
+	"tr":       {"table", "thead", "tbody", "tfoot"},
+	"td":       {"tr", "table"},
+	"th":       {"tr", "table"},
+	"thead":    {"table"},
+	"tbody":    {"table"},
+	"tfoot":    {"table"},
+	"caption":  {"table"},
+	"colgroup": {"table"},
+}
+
+// Elements that the parser closes without an end tag when a later tag ends them.
+// Other elements closed that way can be re-opened or moved by the parser.
+var impliedEndTags = map[string]bool{
+	"p": true, "li": true, "dd": true, "dt": true, "option": true, "optgroup": true,
+	"caption": true, "colgroup": true, "tbody": true, "thead": true, "tfoot": true, "tr": true, "td": true, "th": true,
+}
+
+// Elements whose end tag closes the elements still open inside them, like the parser does.
+// Other end tags only close the element that's currently open.
+var closesDescendants = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "center": true, "details": true,
+	"dialog": true, "dir": true, "div": true, "dl": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "listing": true, "main": true, "menu": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true, "summary": true, "ul": true,
+	"li": true, "dd": true, "dt": true, "select": true, "table": true, "caption": true, "colgroup": true,
+	"tbody": true, "thead": true, "tfoot": true, "tr": true, "td": true, "th": true,
+}
+
+// Start tags that the parser renames, moves, or builds separate trees for.
+var streamUnmodeled = map[string]bool{
+	"image": true, "isindex": true, "template": true, "svg": true, "math": true, "frameset": true, "frame": true,
+	"plaintext": true, "rb": true, "rp": true, "rt": true, "rtc": true,
+}
+
+// Start tags that the parser ignores, or uses to close an open element of the same kind.
+var closesSame = map[string]bool{
+	"a": true, "nobr": true, "button": true, "form": true, "select": true,
+}
+
+// Elements that only hold table rows and cells, where anything else is moved in front of the table.
+var tableSections = map[string]bool{
+	"table": true, "tbody": true, "thead": true, "tfoot": true, "tr": true, "colgroup": true,
+}
+
+// Start tags that can go directly in a table section.
+var tableContent = map[string]bool{
+	"caption": true, "colgroup": true, "col": true, "tbody": true, "thead": true, "tfoot": true,
+	"tr": true, "td": true, "th": true, "script": true, "style": true,
+}
+
+// Start tags that are only kept inside a table, mapped to the elements they go in.
+var tableParents = map[string][]string{
+	"caption":  {"table"},
+	"colgroup": {"table"},
+	"tbody":    {"table"},
+	"thead":    {"table"},
+	"tfoot":    {"table"},
+	"tr":       {"tbody", "thead", "tfoot"},
+	"td":       {"tr"},
+	"th":       {"tr"},
+	"col":      {"colgroup"},
+}
+
+// Heading elements, which the parser treats as one kind of element.
+var headings = []string{"h1", "h2", "h3", "h4", "h5", "h6"}
+
+// streamClose closes n, discarding its children since nothing can match against them anymore,
+// and returns the element that's open afterwards.
+func streamClose(n *html.Node) *html.Node {
+	n.FirstChild, n.LastChild = nil, nil
+	return n.Parent
+}
+
+// streamCloseTo closes the open elements up to and including n, and returns the element that's open afterwards.
+// Returns errNotStreamable if that closes an element the parser would treat differently.
+func streamCloseTo(open, n *html.Node) (*html.Node, error) {
+	for ; open != n; open = streamClose(open) {
+		if !impliedEndTags[open.Data] {
+			return nil, errNotStreamable
+		}
+	}
+	return streamClose(n), nil
+}
+
+// streamFind returns the nearest open element named one of names, stopping at root or
+// at an element named in stop.
+func streamFind(open, root *html.Node, names []string, stop ...string) *html.Node {
+	for n := open; n != root; n = n.Parent {
+		if contains(names, n.Data) {
+			return n
+		}
+		if contains(stop, n.Data) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// contains reports whether name is one of names.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// streamOpen closes the open elements that a start tag named name implicitly
+// ends, and returns the element it should be appended to.
+func streamOpen(open, root *html.Node, name string, quirks bool) (*html.Node, error) {
+	var err error
+	if stop, ok := closesSibling[name]; ok {
+		// <optgroup> ends an open <option> too, and rows and table sections end an open cell or row
+		names := []string{name}
+		switch name {
+		case "optgroup":
+			names = []string{"optgroup", "option"}
+		case "tr":
+			names = []string{"td", "th", "tr"}
+		case "tbody", "thead", "tfoot", "caption", "colgroup":
+			names = []string{"td", "th", "tr", "tbody", "thead", "tfoot"}
+		case "td", "th":
+			names = []string{"td", "th"}
+		case "dd", "dt":
+			names = []string{"dd", "dt"}
+		}
+		for _, sibling := range names {
+			if n := streamFind(open, root, []string{sibling}, stop...); n != nil {
+				if open, err = streamCloseTo(open, n); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if closesParagraph[name] {
+		if n := streamFind(open, root, []string{"p"}, "button", "table", "td", "th", "caption", "applet", "marquee", "object"); n != nil {
+			// in quirks mode, <table> doesn't close an open <p>
+			if name == "table" && quirks {
+				return nil, errNotStreamable
+			}
+			if open, err = streamCloseTo(open, n); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// a heading ends an open heading, even of another level
+	if contains(headings, name) && contains(headings, open.Data) {
+		open = streamClose(open)
+	}
+	return open, nil
+}
+
+// Elements that go in the <head> while the document has no <body> yet.
+var headElements = map[string]bool{
+	"base": true, "basefont": true, "bgsound": true, "link": true, "meta": true, "noframes": true,
+	"noscript": true, "script": true, "style": true, "title": true,
+}
+
+// streamCount counts the elements of the document read from r that match m,
+// without building the whole tree. Only the currently open elements are kept,
+// along with bare copies of their earlier element children, so that
+// ancestor, child, sibling, and nth-child selectors still match.
+// Omitted end tags are closed like the parser does, and the <html>, <head>, <body>,
+// <tbody>, <tr>, and <colgroup> elements that the parser adds when they're missing
+// are added too. For markup that the parser repairs further, like misnested formatting
+// elements, content misplaced inside tables, <template>, or <svg>, it returns errNotStreamable.
+func streamCount(r io.Reader, m goquery.Matcher) (int, error) {
+	z := html.NewTokenizer(r)
+	root := &html.Node{Type: html.DocumentNode}
+	open := root
+	count := 0
+
+	// add appends a new element to parent, counting it if it matches
+	add := func(parent *html.Node, name string, attr []html.Attribute) *html.Node {
+		node := &html.Node{Type: html.ElementNode, Data: name, DataAtom: atom.Lookup([]byte(name)), Attr: attr}
+		parent.AppendChild(node)
+		if m.Match(node) {
+			count++
+		}
+		return node
+	}
+
+	// the parser always creates <html>, <head>, and <body>, in that order
+	var htmlNode, head, body *html.Node
+	headClosed := false
+	// documents that don't start with <!DOCTYPE html> might be parsed in quirks mode
+	quirks, started := true, false
+	openHtml := func(attr []html.Attribute) {
+		if htmlNode == nil {
+			htmlNode = add(root, "html", attr)
+			open = htmlNode
+		}
+	}
+	openHead := func(attr []html.Attribute) {
+		openHtml(nil)
+		if head == nil {
+			head = add(htmlNode, "head", attr)
+			open = head
+		}
+	}
+	openBody := func(attr []html.Attribute) {
+		openHead(nil)
+		if body == nil {
+			body = add(htmlNode, "body", attr)
+			open = body
+		}
+	}
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				openBody(nil)
+				return count, nil
+			}
+			return 0, z.Err()
+		case html.DoctypeToken:
+			if !started {
+				quirks = string(z.Text()) != "html"
+			}
+			started = true
+		case html.TextToken:
+			if strings.TrimLeft(string(z.Text()), "\t\n\f\r ") == "" {
+				continue
+			}
+			started = true
+			// text outside of head elements starts the body
+			if body == nil && (open == root || open == htmlNode || open == head) {
+				openBody(nil)
+			}
+			// and text directly in a table is moved in front of it
+			if tableSections[open.Data] {
+				return 0, errNotStreamable
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			started = true
+			t := z.Token()
+			if streamUnmodeled[t.Data] {
+				return 0, errNotStreamable
+			}
+			switch t.Data {
+			case "html", "body":
+				// the attributes of repeated <html> or <body> tags are added to the first one
+				if (t.Data == "html" && htmlNode != nil || t.Data == "body" && body != nil) && len(t.Attr) > 0 {
+					return 0, errNotStreamable
+				}
+				if t.Data == "html" {
+					openHtml(t.Attr)
+				} else {
+					openBody(t.Attr)
+				}
+				continue
+			case "head":
+				if body == nil {
+					openHead(t.Attr)
+				}
+				continue
+			}
+			if body == nil {
+				// after </head>, head elements other than <noscript> still go in the <head>
+				if headElements[t.Data] && !(headClosed && t.Data == "noscript") {
+					openHead(nil)
+					if headClosed {
+						open = head
+					}
+				} else {
+					openBody(nil)
+				}
+			}
+
+			// a <colgroup> only holds <col> elements
+			if open.Data == "colgroup" && t.Data != "col" {
+				open = streamClose(open)
+			}
+			if tableSections[open.Data] && !tableContent[t.Data] {
+				return 0, errNotStreamable
+			}
+			// a <select> only holds options, and outside of one, only an open <option> is closed
+			inSelect := streamFind(open, root, []string{"select"}) != nil
+			if inSelect && t.Data != "option" && t.Data != "optgroup" {
+				return 0, errNotStreamable
+			}
+			if !inSelect && (t.Data == "option" || t.Data == "optgroup") {
+				if open.Data == "option" {
+					open = streamClose(open)
+				}
+				if streamFind(open, root, []string{"option", "optgroup"}) != nil {
+					return 0, errNotStreamable
+				}
+			}
+			if closesSame[t.Data] && streamFind(open, root, []string{t.Data}) != nil {
+				return 0, errNotStreamable
+			}
+
+			var err error
+			if open, err = streamOpen(open, root, t.Data, quirks); err != nil {
+				return 0, err
+			}
+			// rows and cells written directly in a table get their missing parents
+			switch t.Data {
+			case "tr":
+				if open.Data == "table" {
+					open = add(open, "tbody", nil)
+				}
+			case "td", "th":
+				if open.Data == "table" {
+					open = add(open, "tbody", nil)
+				}
+				if open.Data == "tbody" || open.Data == "thead" || open.Data == "tfoot" {
+					open = add(open, "tr", nil)
+				}
+			case "col":
+				if open.Data == "table" {
+					open = add(open, "colgroup", nil)
+				}
+			}
+			// and are ignored anywhere else
+			if parents, ok := tableParents[t.Data]; ok && !contains(parents, open.Data) {
+				return 0, errNotStreamable
+			}
+
+			node := add(open, t.Data, t.Attr)
+			// self-closing tags are only closed in <svg> and <math>, which aren't streamed
+			if !voidElements[t.Data] {
+				open = node
+			} else if headClosed && open == head {
+				open = htmlNode
+			}
+		case html.EndTagToken:
+			started = true
+			t := z.Token()
+			// content after </body> or </html> still goes in the body, which they start if there's none yet
+			switch t.Data {
+			case "body", "html":
+				openBody(nil)
+				continue
+			case "head":
+				// head elements can still be added to the <head> after it, so its children are kept
+				if body == nil {
+					openHead(nil)
+					open, headClosed = htmlNode, true
+				}
+				continue
+			}
+			names := []string{t.Data}
+			if contains(headings, t.Data) {
+				// any heading's end tag closes the open heading
+				names = headings
+			}
+			n := streamFind(open, root, names)
+			switch {
+			case n == nil:
+				// the parser ignores most stray end tags, but adds a <p> or <br> for them
+				if t.Data == "p" || t.Data == "br" {
+					return 0, errNotStreamable
+				}
+			case n.Data != t.Data, n != open && !closesDescendants[t.Data]:
+				return 0, errNotStreamable
+			default:
+				var err error
+				if open, err = streamCloseTo(open, n); err != nil {
+					return 0, err
+				}
+				if headClosed && open == head {
+					open = htmlNode
+				}
+			}
+		}
+	}
+}
+
+// streamText concatenates the text of the document read from r, without
+// building the whole tree. For well-formed documents, this is the same as the
+// text of the parsed document.
+func streamText(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	var buf strings.Builder
+	// the parser drops whitespace before the document's first content
+	started := false
+	// and a newline right after <pre>, <listing>, or <textarea>
+	skipNewline := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return buf.String(), nil
+			}
+			return "", z.Err()
+		case html.TextToken:
+			text := string(z.Text())
+			if skipNewline {
+				text = strings.TrimPrefix(text, "\n")
+			}
+			if !started {
+				text = strings.TrimLeft(text, "\t\n\f\r ")
+				started = text != ""
+			}
+			buf.WriteString(text)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Html:
+			case atom.Pre, atom.Listing, atom.Textarea:
+				started = true
+				skipNewline = tt == html.StartTagToken
+				continue
+			default:
+				started = true
+			}
+		}
+		skipNewline = false
+	}
+}
+
+/** html_count_stream(document, selector)
+ * Count the number of matching selected elements in the given document, like html_count,
+ * but without holding the whole parsed document in memory.
+ * Documents that the parser has to repair beyond closing omitted end tags are parsed like in html_count.
+ * Selectors that depend on an element's contents or later siblings aren't supported.
+ * Raises an error if document is not proper HTML, or if selector isn't supported.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlCountStreamFunc struct{}
+
+func (*HtmlCountStreamFunc) Deterministic() bool { return true }
+func (*HtmlCountStreamFunc) Args() int           { return 2 }
+func (*HtmlCountStreamFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	// documents from html_parse are already in memory, so there's nothing to save
+	if handle, ok := values[0].Pointer().(*HtmlDocument); ok {
+		matches, err := findAll(handle.Selection, selector)
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		c.ResultInt(matches.Length())
+		return
+	}
+
+	m, err := streamMatcher(selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	source, err := documentSource(values[0])
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	count, err := streamCount(strings.NewReader(source), m)
+	if err == errNotStreamable {
+		// the parser repairs this document in ways streamCount doesn't, so it's parsed after all
+		doc, parseErr := parseHtmlDocument(source)
+		if parseErr != nil {
+			c.ResultError(parseErr)
+			return
+		}
+		count, err = doc.FindMatcher(m).Length(), nil
+	}
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultInt(count)
+}
+
+/** html_text_stream(document)
+ * Returns the combined text contents of document, like html_text, but without
+ * holding the whole parsed document in memory.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ */
+type HtmlTextStreamFunc struct{}
+
+func (*HtmlTextStreamFunc) Deterministic() bool { return true }
+func (*HtmlTextStreamFunc) Args() int           { return 1 }
+func (*HtmlTextStreamFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	if handle, ok := values[0].Pointer().(*HtmlDocument); ok {
+		c.ResultText(handle.Text())
+		return
+	}
+
+	source, err := documentSource(values[0])
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	text, err := streamText(strings.NewReader(source))
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(text)
+}
+
+func RegisterStream(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_count_stream", &HtmlCountStreamFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_stream", &HtmlTextStreamFunc{}); err != nil {
+		return err
+	}
+	return nil
+}
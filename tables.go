@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+)
+
+// tableRows returns the rows of table, skipping the rows of any tables nested inside it.
+func tableRows(table *goquery.Selection) *goquery.Selection {
+	return table.Find("tr").FilterFunction(func(i int, tr *goquery.Selection) bool {
+		return tr.Closest("table").IsSelection(table)
+	})
+}
+
+// cellText returns the text of a table cell, with whitespace collapsed and trimmed.
+func cellText(cell *goquery.Selection) string {
+	return strings.Join(strings.Fields(cell.Text()), " ")
+}
+
+// tableHeader picks the header row out of a table's rows: the first row in
+// its <thead>, or else its first row with a <th> cell, or else its first row.
+func tableHeader(rows *goquery.Selection) *goquery.Selection {
+	header := rows.FilterFunction(func(i int, tr *goquery.Selection) bool {
+		return tr.Parent().Is("thead")
+	}).First()
+	if header.Length() == 0 {
+		header = rows.FilterFunction(func(i int, tr *goquery.Selection) bool {
+			return tr.ChildrenFiltered("th").Length() > 0
+		}).First()
+	}
+	if header.Length() == 0 {
+		header = rows.First()
+	}
+	return header
+}
+
+// tableKeys returns the text of each cell in a table's header row, and a key for
+// each column past it up to width. Empty and repeated headers, and the columns
+// past the header, fall back to the column index, suffixed with a count if a
+// header already has that text, so no cell is lost.
+func tableKeys(header *goquery.Selection, width int) []string {
+	texts := []string{}
+	header.ChildrenFiltered("th, td").Each(func(i int, cell *goquery.Selection) {
+		texts = append(texts, cellText(cell))
+	})
+	for len(texts) < width {
+		texts = append(texts, "")
+	}
+
+	// the first cell with a text keeps it, before any fallback is picked
+	keys := make([]string, len(texts))
+	seen := map[string]bool{}
+	for i, text := range texts {
+		if text != "" && !seen[text] {
+			seen[text] = true
+			keys[i] = text
+		}
+	}
+	for i := range keys {
+		if keys[i] != "" {
+			continue
+		}
+		key := strconv.Itoa(i)
+		for n := 2; seen[key]; n++ {
+			key = strconv.Itoa(i) + "_" + strconv.Itoa(n)
+		}
+		seen[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+/** html_table_to_json(document, selector)
+ * Returns a JSON array with an object for every row of the first table in document matching selector,
+ * mapping the text of each header cell to the text of the row's cell in the same column.
+ * The header is the first row of the table's <thead>, or else its first row with a <th> cell, or else its first row.
+ * Returns NULL if no table matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which table in document to read.
+ */
+type HtmlTableToJsonFunc struct{}
+
+func (*HtmlTableToJsonFunc) Deterministic() bool { return true }
+func (*HtmlTableToJsonFunc) Args() int           { return 2 }
+func (*HtmlTableToJsonFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	table, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if table.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	rows := tableRows(table)
+	header := tableHeader(rows)
+	width := 0
+	for i := range rows.Nodes {
+		if cells := rows.Eq(i).ChildrenFiltered("th, td").Length(); cells > width {
+			width = cells
+		}
+	}
+	keys := tableKeys(header, width)
+	columns := header.ChildrenFiltered("th, td").Length()
+
+	// objects are written by hand, since encoding/json sorts map keys instead of keeping the column order
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	first := true
+	for i := range rows.Nodes {
+		row := rows.Eq(i)
+		if row.IsSelection(header) {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		cells := row.ChildrenFiltered("th, td")
+		buf.WriteByte('{')
+		for j := 0; j < columns || j < cells.Length(); j++ {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			k, _ := json.Marshal(keys[j])
+			buf.Write(k)
+			buf.WriteByte(':')
+			if j < cells.Length() {
+				v, _ := json.Marshal(cellText(cells.Eq(j)))
+				buf.Write(v)
+			} else {
+				buf.WriteString("null")
+			}
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+
+	c.ResultText(buf.String())
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+/** html_table_headers(document, selector)
+ * Returns a JSON array of the text of each header cell of the first table in document matching selector,
+ * the same keys html_table_to_json uses for its objects. Returns an empty array if the table has no rows,
+ * or NULL if no table matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which table in document to read.
+ */
+type HtmlTableHeadersFunc struct{}
+
+func (*HtmlTableHeadersFunc) Deterministic() bool { return true }
+func (*HtmlTableHeadersFunc) Args() int           { return 2 }
+func (*HtmlTableHeadersFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	table, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if table.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	keys, err := json.Marshal(tableKeys(tableHeader(tableRows(table)), 0))
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(string(keys))
+	c.ResultSubType(JSON_SUBTYPE)
+}
+
+func RegisterTables(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_table_headers", &HtmlTableHeadersFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_table_to_json", &HtmlTableToJsonFunc{}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,3 +1,4 @@
+import json
 import sqlite3
 import unittest
 
@@ -5,30 +6,126 @@ EXT_PATH = "dist/html0"
 
 FUNCTIONS = [
     "html",
+    "html_absolutize",
+    "html_absolutize",
+    "html_accessible_text",
+    "html_accessible_text",
+    "html_accessible_text",
+    "html_add_class",
+    "html_agg",
+    "html_agg",
+    "html_attr_all",
+    "html_attr_exists",
     "html_attr_get",
     "html_attr_has",
     "html_attribute_get",
     "html_attribute_has",
+    "html_base",
+    "html_canonical",
+    "html_clean_attributes",
+    "html_clean_attributes",
+    "html_closest",
+    "html_concat",
+    "html_contains_text",
+    "html_contains_text",
     "html_count",
+    "html_count_agg",
+    "html_count_attr",
+    "html_count_distinct_text",
+    "html_count_missing_attr",
+    "html_count_stream",
     "html_debug",
+    "html_decode",
+    "html_decode",
+    "html_decode_entities",
+    "html_dedupe",
+    "html_depth",
+    "html_depth",
+    "html_each_json",
     "html_element",
+    "html_equal",
     "html_escape",
     "html_extract",
+    "html_extract",
+    "html_extract_all_text",
+    "html_extract_all_text",
+    "html_extract_between",
+    "html_extract_first",
+    "html_extract_fragment",
+    "html_extract_json",
+    "html_find_attr_regex",
+    "html_find_attr_regex",
+    "html_find_text",
+    "html_find_text",
+    "html_first_text",
     "html_group_element_div",
     "html_group_element_span",
+    "html_hash",
+    "html_hash",
+    "html_highlight",
+    "html_highlight",
+    "html_highlight",
+    "html_lang",
+    "html_lang",
+    "html_matches",
+    "html_next_text",
+    "html_normalize",
+    "html_normalize_whitespace",
+    "html_normalize_whitespace",
+    "html_nth",
+    "html_offset",
+    "html_outer_all",
+    "html_parse",
+    "html_pluck",
+    "html_prev_text",
+    "html_remove",
+    "html_remove_class",
+    "html_remove_comments",
+    "html_replace",
+    "html_replace_text",
+    "html_replace_text",
+    "html_rewrite_urls",
+    "html_set_attr",
+    "html_set_base",
+    "html_size",
+    "html_size",
+    "html_strip",
+    "html_strip",
+    "html_strip_empty",
+    "html_strip_empty",
     "html_table",
+    "html_table_headers",
+    "html_table_to_json",
+    "html_tag",
     "html_text",
     "html_text",
+    "html_text_all",
+    "html_text_length",
+    "html_text_length",
+    "html_text_lines",
+    "html_text_lines",
+    "html_text_stream",
     "html_trim",
+    "html_truncate_text",
+    "html_truncate_text",
     "html_unescape",
+    "html_unwrap",
     "html_valid",
     "html_version",
+    "html_word_count",
+    "html_word_count",
+    "html_wrap",
   ]
 MODULES = [
-  "html_each"
+  "html_children",
+  "html_each",
+  "html_scripts",
+  "html_select_options",
+  "html_styles",
+  "html_text_blocks",
 ]
 
-ALIASES = ["html_attr_get", "html_attr_has"]
+ALIASES = ["html_attr_exists", "html_attr_get", "html_attr_has"]
 
 def connect(ext):
   db = sqlite3.connect(":memory:")
@@ -72,6 +169,20 @@ class TestHtml(unittest.TestCase):
     self.assertTrue(lines[2].startswith("Runtime"))
     self.assertTrue(lines[3].startswith("Date"))
 
+  def test_html_decode(self):
+    a, b, c, d = db.execute("""select
+      html_decode(X'636166E9', 'windows-1252'),
+      html_text(html_decode(X'3C6D65746120636861727365743D77696E646F77732D313235323E3C703E636166E9'), 'p'),
+      html_text(html_decode(X'3C6D65746120636861727365743D73686966745F6A69733E3C703E93FA967B'), 'p'),
+      html_decode(X'EFBBBF636166C3A9')
+    """).fetchone()
+    self.assertEqual(a, "café")
+    self.assertEqual(b, "café")
+    self.assertEqual(c, "日本")
+    self.assertEqual(d, "café")
+    with self.assertRaisesRegex(sqlite3.OperationalError, "unknown charset"):
+      db.execute("select html_decode('a', 'not-a-charset')").fetchone()
+
   def test_html_table(self):
     d, = db.execute("select html_table('a')").fetchone()
     self.assertEqual(d, "<table>a")
@@ -84,6 +195,23 @@ class TestHtml(unittest.TestCase):
     d, = db.execute("select html_unescape('&lt;a')").fetchone()
     self.assertEqual(d, "<a")
   
+  def test_html_decode_entities(self):
+    a, b, c, d, e, f = db.execute("""select
+      html_decode_entities('&lt;a&gt; &amp; caf&eacute; &notit; &NotEqualTilde;'),
+      html_decode_entities('&#233; &#xE9; &#XE9'),
+      html_decode_entities('&#128512; &#x1F600; &#x1f600'),
+      html_decode_entities('&#xD83D;&#xDE00; &#x110000;'),
+      html_decode_entities('&#150;'),
+      html_decode_entities('&unknown; &')
+    """).fetchone()
+    self.assertEqual(a, "<a> & café ¬it; ≂̸")
+    self.assertEqual(b, "é é é")
+    self.assertEqual(c, "😀 😀 😀")
+    self.assertEqual(c.encode("utf-8"), b"\xf0\x9f\x98\x80 \xf0\x9f\x98\x80 \xf0\x9f\x98\x80")
+    self.assertEqual(d, "\ufffd\ufffd \ufffd")
+    self.assertEqual(e, "\u2013")
+    self.assertEqual(f, "&unknown; &")
+
   def test_html_trim(self):
     a,b = db.execute("""select html_trim('  a '), html_trim('
     bb 
@@ -115,6 +243,29 @@ class TestHtml(unittest.TestCase):
     # TODO what should this do
     self.assertEqual(c, "<p><span>My name is </span><b>Alex Garcia</b>.</p>")
 
+  def test_html_attr_all(self):
+    a, b, c = db.execute("""select
+      html_attr_all('<a href="/a">A</a> <a>B</a> <a href="">C</a> <a href="/&quot;d">D</a>', 'a', 'href'),
+      html_attr_all('<p>a</p>', 'a', 'href'),
+      json_array_length(html_attr_all('<img src=x><img src=y>', 'img', 'src'))
+    """).fetchone()
+    self.assertEqual(json.loads(a), ["/a", "", "/\"d"])
+    self.assertEqual(b, "[]")
+    self.assertEqual(c, 2)
+
+  def test_html_count_attr(self):
+    doc = '<img src=a alt="A"><img src=b alt=""><img src=c><p alt=x></p>'
+    a, b, c, d = db.execute("""select
+      html_count_attr(?1, 'img', 'alt'),
+      html_count_missing_attr(?1, 'img', 'alt'),
+      html_count_attr(?1, 'video', 'src'),
+      html_count_missing_attr(?1, 'video', 'src')
+    """, [doc]).fetchone()
+    self.assertEqual(a, 2)
+    self.assertEqual(b, 1)
+    self.assertEqual(c, 0)
+    self.assertEqual(d, 0)
+
   def test_html_attribute_has(self):
     a, b, c = db.execute("""select 
       html_attribute_has('<p x>', 'p', 'x'), 
@@ -124,6 +275,14 @@ class TestHtml(unittest.TestCase):
     self.assertEqual(a, 1)
     self.assertEqual(b, 0)
     self.assertEqual(c, 1)
+    d, e, f = db.execute("""select
+      html_attr_exists('<button disabled>Go</button>', 'button', 'disabled'),
+      html_attr_exists('<button>Go</button>', 'button', 'disabled'),
+      html_attr_exists('<p>abc', 'button', 'disabled')
+    """).fetchone()
+    self.assertEqual(d, 1)
+    self.assertEqual(e, 0)
+    self.assertEqual(f, 0)
   
   def test_html_attribute_get(self):
     a, b, c = db.execute("""select 
@@ -144,6 +303,17 @@ class TestHtml(unittest.TestCase):
     self.assertEqual(a, "<p a=\"b\">abc</p>")
     self.assertEqual(b, "<p>abc</p>")
     self.assertEqual(c, None)
+
+    d, e, f, g = db.execute("""select
+      html_extract('<li>a</li><li>b</li><li>c</li>', 'li', 2),
+      html_extract('<li>a</li><li>b</li><li>c</li>', 'li', -1),
+      html_extract('<li>a</li>', 'li', 0),
+      html_extract('<li>a</li>', 'li', 2)
+    """).fetchone()
+    self.assertEqual(d, "<li>b</li>")
+    self.assertEqual(e, "<li>c</li>")
+    self.assertEqual(f, None)
+    self.assertEqual(g, None)
   
   def test_html_text(self):
     a, b, c = db.execute("""select 
@@ -155,16 +325,421 @@ class TestHtml(unittest.TestCase):
     self.assertEqual(b, "abc")
     self.assertEqual(c, None)
   
+  def test_blob_documents(self):
+    page = b'<meta charset=windows-1252><title>caf\xe9</title><p>a</p><p>b</p>'
+    a, b, c, d = db.execute("""select
+      html_text(?1, 'title'),
+      html_extract(?1, 'title'),
+      html_count(?1, 'p'),
+      html_extract_fragment(?1, 'title')
+    """, [page]).fetchone()
+    self.assertEqual(a, "café")
+    self.assertEqual(b, "<title>café</title>")
+    self.assertEqual(c, 2)
+    self.assertEqual(d, "<title>café</title>")
+
+    rows = db.execute("select text from html_each(?, 'title, p')", [page]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["café", "a", "b"])
+
+    self.assertEqual(db.execute("select html_text(?)", ["café".encode("utf-8")]).fetchone()[0], "café")
+
+  def test_html_accessible_text(self):
+    a, b, c, d, e = db.execute("""select
+      html_accessible_text('<p>Made by <img src="logo.png" alt="ACME"> in 2024<span aria-hidden="true">*</span></p><script>x</script>'),
+      html_accessible_text('<p><abbr title="HyperText Markup Language">HTML</abbr> rocks<img alt="" title="tooltip"></p>', 'p', 1),
+      html_accessible_text('<p><abbr title="HTML">HTML</abbr><img alt="Logo" title="Logo"><input type=IMAGE alt="Go"></p><p hidden>x</p>', 'body', 1),
+      html_accessible_text('<p><abbr title="HyperText Markup Language">HTML</abbr></p>', 'p'),
+      html_accessible_text('<p>a</p>', 'div')
+    """).fetchone()
+    self.assertEqual(a, "Made by ACME in 2024")
+    self.assertEqual(b, "HTML (HyperText Markup Language) rocks (tooltip)")
+    self.assertEqual(c, "HTMLLogoGo")
+    self.assertEqual(d, "HTML")
+    self.assertEqual(e, None)
+
+  def test_html_contains_text(self):
+    doc = '<li>Apples</li><li>Ba<b>nanas</b></li><p>Cherries</p>'
+    a, b, c, d, e, f = db.execute("""select
+      html_contains_text(?1, 'li', 'Banana'),
+      html_contains_text(?1, 'li', 'BANANA'),
+      html_contains_text(?1, 'li', 'BANANA', 1),
+      html_contains_text(?1, 'li', 'Cherries'),
+      html_contains_text(?1, 'td', ''),
+      html_contains_text('<p>ÉCOLE</p>', 'p', 'école', 1)
+    """, [doc]).fetchone()
+    self.assertEqual(a, 1)
+    self.assertEqual(b, 0)
+    self.assertEqual(c, 1)
+    self.assertEqual(d, 0)
+    self.assertEqual(e, 0)
+    self.assertEqual(f, 1)
+
+  def test_html_first_text(self):
+    a, b, c, d = db.execute("""select
+      html_first_text('<h1>Title <b>x</b></h1><h1>Other</h1>', 'h1', 'Untitled'),
+      html_first_text('<p>no heading</p>', 'h1', 'Untitled'),
+      html_first_text('<p>no heading</p>', 'h1', null),
+      html_first_text('<h1></h1>', 'h1', 'Untitled')
+    """).fetchone()
+    self.assertEqual(a, "Title x")
+    self.assertEqual(b, "Untitled")
+    self.assertEqual(c, None)
+    self.assertEqual(d, None)
+
+  def test_html_truncate_text(self):
+    a, b, c, d, e, f, g = db.execute("""select
+      html_truncate_text('<p>The quick brown fox jumps</p>', 'p', 12),
+      html_truncate_text('<p>The quick brown fox jumps</p>', 'p', 15, ' [more]'),
+      html_truncate_text('<p>Short</p>', 'p', 5),
+      html_truncate_text('<p>Supercalifragilistic</p>', 'p', 5, '...'),
+      html_truncate_text('<p>héllo wörld ünïcode</p>', 'p', 11),
+      html_truncate_text('<p>a b</p>', 'p', 0),
+      html_truncate_text('<p>a</p>', 'div', 3)
+    """).fetchone()
+    self.assertEqual(a, "The quick…")
+    self.assertEqual(b, "The quick brown [more]")
+    self.assertEqual(c, "Short")
+    self.assertEqual(d, "Super...")
+    self.assertEqual(e, "héllo wörld…")
+    self.assertEqual(f, "…")
+    self.assertEqual(g, None)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "must not be negative"):
+      db.execute("select html_truncate_text('<p>a</p>', 'p', -1)").fetchone()
+
+  def test_html_next_prev_text(self):
+    doc = '<dl><dt>Price</dt> <!-- c --> <dd>$10</dd><dt>Stock</dt><dd>4 <b>left</b></dd></dl>'
+    a, b, c, d, e = db.execute("""select
+      html_next_text(?1, 'dt:contains("Stock")'),
+      html_next_text(?1, 'dt'),
+      html_prev_text(?1, 'dd'),
+      html_prev_text(?1, 'dt'),
+      html_next_text(?1, 'p')
+    """, [doc]).fetchone()
+    self.assertEqual(a, "4 left")
+    self.assertEqual(b, "$10")
+    self.assertEqual(c, "Price")
+    self.assertEqual(d, None)
+    self.assertEqual(e, None)
+
+  def test_html_extract_all_text(self):
+    a, b, c, d = db.execute("""select
+      html_extract_all_text('<article><p>First
+        paragraph.</p><p> </p><p>Second <b>one</b>.</p></article>', 'p'),
+      html_extract_all_text('<ul><li> a </li><li>b</li></ul>', 'li', ', '),
+      html_extract_all_text('<ul><li>a</li><li>b</li></ul>', 'li', null),
+      html_extract_all_text('<p>x</p>', 'li')
+    """).fetchone()
+    self.assertEqual(a, "First paragraph.\nSecond one.")
+    self.assertEqual(b, "a, b")
+    self.assertEqual(c, "a\nb")
+    self.assertEqual(d, None)
+
+  def test_html_text_all(self):
+    a, b, c = db.execute("""select
+      html_text_all('<ul><li>a</li><li>b <b>c</b></li><li>d</li></ul>', 'li', char(10)),
+      html_text_all('<p>x</p><p>y</p>', 'p', ''),
+      html_text_all('<p>x</p>', 'li', ', ')
+    """).fetchone()
+    self.assertEqual(a, "a\nb c\nd")
+    self.assertEqual(b, "xy")
+    self.assertEqual(c, None)
+
+  def test_html_text_blocks(self):
+    rows = db.execute("""select *
+    from html_text_blocks('<h1>Title</h1>
+    <p>First   paragraph.</p>
+    <ul><li>One</li><li>Two: <p>nested</p> after</li><li><p>Three</p></li><li> </li></ul>
+    <blockquote>Quote <script>var a;</script><style>p {}</style></blockquote>
+    <table><tr><th>a</th><td>b</td></tr></table>
+    <div>loose</div>')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      (0, "h1", "Title"),
+      (1, "p", "First paragraph."),
+      (2, "li", "One"),
+      (3, "li", "Two: after"),
+      (4, "p", "nested"),
+      (5, "p", "Three"),
+      (6, "blockquote", "Quote"),
+      (7, "th", "a"),
+      (8, "td", "b"),
+    ])
+
+    rows = db.execute("""select text
+    from html_text_blocks('<p>a</p><article><p>b</p><p>c</p></article>', 'article')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["b", "c"])
+
+    rows = db.execute("select text from html_text_blocks('<p>a</p>', 'article')").fetchall()
+    self.assertEqual(rows, [])
+
+  def test_html_text_lines(self):
+    a, b, c, d = db.execute("""select
+      html_text_lines('<address>Jane   Doe<br>1 Main St.<br>
+        Springfield</address>'),
+      html_text_lines('<div>x<div><p>One <b>two</b></p><p>three</p></div>y</div><script>z</script>'),
+      html_text_lines('<table><tr><td>a</td><td>b</td></tr><tr><td>c</td></tr></table>', 'table'),
+      html_text_lines('<p>a</p>', 'div')
+    """).fetchone()
+    self.assertEqual(a, "Jane Doe\n1 Main St.\nSpringfield")
+    self.assertEqual(b, "x\nOne two\nthree\ny")
+    self.assertEqual(c, "a b\nc")
+    self.assertEqual(d, None)
+
   def test_html_valid(self):
     html_valid = lambda x: db.execute("select html_valid(?)", [x]).fetchone()[0]
     self.assertEqual(html_valid("<div>a"), 1)
     # TODO wtf isn't valid HTML
   
+  def test_html_concat(self):
+    a, b, c, d = db.execute("""select
+      html_concat('<p>a</p>', '<html><head><title>t</title></head><body><p>b</p></body></html>'),
+      html_concat('<li>a', null, html_parse('<li>b</li>'), '<style>p {}</style><li>c</li>'),
+      html_concat(),
+      html_concat('<p>a</p>')
+    """).fetchone()
+    self.assertEqual(a, "<html><head><title>t</title></head><body><p>a</p><p>b</p></body></html>")
+    self.assertEqual(b, "<html><head><style>p {}</style></head><body><li>a</li><li>b</li><li>c</li></body></html>")
+    self.assertEqual(c, "<html><head></head><body></body></html>")
+    self.assertEqual(d, "<html><head></head><body><p>a</p></body></html>")
+
+  def test_html_agg(self):
+    a, b, c = db.execute("""select
+      (select html_agg(html) from html_each('<p>a</p><p>b</p>', 'p')),
+      (select html_agg(html, '<hr>') from html_each('<p>a</p><p>b</p>', 'p')),
+      (select html_element('div', null, html_agg(html)) from html_each('<p>a</p><p>b</p>', 'p'))
+    """).fetchone()
+    self.assertEqual(a, "<p>a</p><p>b</p>")
+    self.assertEqual(b, "<p>a</p><hr><p>b</p>")
+    self.assertEqual(c, "<div><p>a</p><p>b</p></div>")
+
   def test_html_group_element_div(self):
     self.skipTest("")
   def test_html_group_element_span(self):
     self.skipTest("")
 
+  def test_html_extract_fragment(self):
+    a, b, c, d = db.execute("""select
+      html_extract_fragment('<li>x</li>', '*'),
+      html_extract_fragment('<title>a</title><p>b</p>', 'title + p'),
+      html_extract_fragment('<p>a</p>', 'body'),
+      html_extract_fragment(html_parse('<li>x</li>'), '*')
+    """).fetchone()
+    self.assertEqual(a, "<li>x</li>")
+    self.assertEqual(b, "<p>b</p>")
+    self.assertEqual(c, None)
+    self.assertEqual(d, "<li>x</li>")
+
+  def test_html_extract_json(self):
+    a, b = db.execute("""select
+      html_extract_json('<p>Go <a href="/a" class="x">home <b>now</b></a></p><a>2</a>', 'a'),
+      html_extract_json('<p>a</p>', 'a')
+    """).fetchone()
+    self.assertEqual(json.loads(a), {
+      "tag": "a",
+      "text": "home now",
+      "html": "<a href=\"/a\" class=\"x\">home <b>now</b></a>",
+      "attrib": {"class": "x", "href": "/a"},
+    })
+    self.assertEqual(b, None)
+    self.assertIn('"html":"<a href=', a)
+
+  def test_html_nth(self):
+    a, b, c, d, e = db.execute("""select
+      html_nth('<a>1</a><a>2</a><a>3</a>', 'a', 1),
+      html_nth('<a>1</a><a>2</a><a>3</a>', 'a', 3),
+      html_nth('<a>1</a><a>2</a><a>3</a>', 'a', -1),
+      html_nth('<a>1</a><a>2</a><a>3</a>', 'a', 4),
+      html_nth('<a>1</a><a>2</a><a>3</a>', 'a', 0)
+    """).fetchone()
+    self.assertEqual(a, "<a>1</a>")
+    self.assertEqual(b, "<a>3</a>")
+    self.assertEqual(c, "<a>3</a>")
+    self.assertEqual(d, None)
+    self.assertEqual(e, None)
+
+  def test_html_lang(self):
+    doc = """<html lang="en"><body>
+      <p>Hello</p>
+      <div lang="fr"><p>Bonjour <b>!</b></p><p lang="">?</p></div>
+      <svg lang="de" xml:lang="nl"><text>hoi</text></svg>
+    </body></html>"""
+    a, b, c, d, e, f, g = db.execute("""select
+      html_lang(?1),
+      html_lang(?1, 'p'),
+      html_lang(?1, 'b'),
+      html_lang(?1, 'p[lang=""]'),
+      html_lang(?1, 'text'),
+      html_lang(?1, 'table'),
+      html_lang('<p>a</p>', 'p')
+    """, [doc]).fetchone()
+    self.assertEqual(a, "en")
+    self.assertEqual(b, "en")
+    self.assertEqual(c, "fr")
+    self.assertEqual(d, None)
+    self.assertEqual(e, "nl")
+    self.assertEqual(f, None)
+    self.assertEqual(g, None)
+
+  def test_html_matches(self):
+    a, b, c = db.execute("""select
+      html_matches('<div><p class=x>a</p></div>', 'p.x'),
+      html_matches('<div><p>a</p></div>', 'p.x'),
+      html_matches('', 'p')
+    """).fetchone()
+    self.assertEqual(a, 1)
+    self.assertEqual(b, 0)
+    self.assertEqual(c, 0)
+
+  def test_html_closest(self):
+    a, b, c, d = db.execute("""select
+      html_closest('<article id=a><p><b>x</b></p></article>', 'b', 'article'),
+      html_closest('<div class=x><div><b>x</b></div></div>', 'b', 'div'),
+      html_closest('<p><b>x</b></p>', 'b', 'article'),
+      html_closest('<p><b>x</b></p>', 'i', 'p')
+    """).fetchone()
+    self.assertEqual(a, "<article id=\"a\"><p><b>x</b></p></article>")
+    self.assertEqual(b, "<div><b>x</b></div>")
+    self.assertEqual(c, None)
+    self.assertEqual(d, None)
+
+  def test_html_table_headers(self):
+    a, b, c, d, e, f = db.execute("""select
+      html_table_headers('<table>
+        <tr><th> Full
+          name </th><th>Age</th><th></th><th>Age</th></tr>
+        <tr><td>Alex</td><td>1</td></tr>
+      </table>', 'table'),
+      html_table_headers('<table id=t>
+        <tr><td colspan=2>Results</td></tr>
+        <tr><th>A</th><th>B</th></tr>
+        <tr><td>1</td><td>2</td></tr>
+      </table>', '#t'),
+      html_table_headers('<table><thead><tr><td>x</td></tr></thead><tr><th>y</th></tr></table>', 'table'),
+      html_table_headers('<table><tr><td>a</td><td>b</td></tr></table>', 'table'),
+      html_table_headers('<table></table>', 'table'),
+      html_table_headers('<p>a</p>', 'table')
+    """).fetchone()
+    self.assertEqual(a, '["Full name","Age","2","3"]')
+    self.assertEqual(b, '["A","B"]')
+    self.assertEqual(c, '["x"]')
+    self.assertEqual(d, '["a","b"]')
+    self.assertEqual(e, '[]')
+    self.assertEqual(f, None)
+    g = db.execute("""select
+      html_table_headers('<table><tr><th>1</th><th></th><th>0</th><th></th></tr></table>', 'table')
+    """).fetchone()[0]
+    self.assertEqual(g, '["1","1_2","0","3"]')
+
+  def test_html_table_to_json(self):
+    a, b, c, d = db.execute("""select
+      html_table_to_json('<table>
+        <tr><th>Name</th><th> Age </th></tr>
+        <tr><td>Alex</td><td>1</td></tr>
+        <tr><td>Brian</td></tr>
+        <tr><td>Craig</td><td>3</td><td>extra</td></tr>
+      </table>', 'table'),
+      html_table_to_json('<table id=t>
+        <caption>x</caption>
+        <thead><tr><td></td><th>A</th><th>A</th></tr></thead>
+        <tbody><tr><th>r1</th><td>1<table><tr><td>nested</td></tr></table></td><td>2</td></tr></tbody>
+      </table>', '#t'),
+      html_table_to_json('<table><tr><th>only</th></tr></table>', 'table'),
+      html_table_to_json('<p>a</p>', 'table')
+    """).fetchone()
+    e = db.execute("""select html_table_to_json('<table>
+      <tr><td colspan=2>Results</td></tr>
+      <tr><th>A</th><th>B</th></tr>
+      <tr><td>1</td><td>2</td></tr>
+    </table>', 'table')""").fetchone()[0]
+    self.assertEqual(a, '[{"Name":"Alex","Age":"1"},{"Name":"Brian","Age":null},{"Name":"Craig","Age":"3","2":"extra"}]')
+    self.assertEqual(json.loads(b), [{"0": "r1", "A": "1nested", "2": "2"}])
+    self.assertEqual(c, "[]")
+    self.assertEqual(d, None)
+    self.assertEqual(json.loads(e), [{"A": "Results", "B": None}, {"A": "1", "B": "2"}])
+    f = db.execute("""select html_table_to_json('<table>
+      <tr><th>2</th><th></th></tr>
+      <tr><td>a</td><td>b</td><td>c</td></tr>
+    </table>', 'table')""").fetchone()[0]
+    self.assertEqual(f, '[{"2":"a","1":"b","2_2":"c"}]')
+
+  def test_html_pluck(self):
+    doc = '<h1>Lamp</h1><span class="price">$20</span><img src="lamp.jpg"><a title="x@y" href="/b">B</a>'
+    pluck = lambda mapping: db.execute("select html_pluck(?, ?)", [doc, mapping]).fetchone()[0]
+    self.assertEqual(
+      pluck('{"title": "h1", "price": ".price", "img": "img@src", "alt": "img@alt", "missing": "table"}'),
+      '{"title":"Lamp","price":"$20","img":"lamp.jpg","alt":null,"missing":null}'
+    )
+    self.assertEqual(pluck('{"z": "h1@html", "a": "a[title=\\"x@y\\"]", "b": "a[title=\\"x@y\\"]@href"}'), '{"z":"<h1>Lamp</h1>","a":"B","b":"/b"}')
+    self.assertEqual(pluck('{"a": "h1", "a": "a"}'), '{"a":"B"}')
+    self.assertEqual(pluck('{}'), '{}')
+
+    for mapping, error in [
+      ('["h1"]', "mapping must be a JSON object"),
+      ('nope', "mapping must be a JSON object"),
+      ('{"a": 1}', 'selector for "a" must be a string'),
+      ('{"a": "p["}', 'a: invalid selector'),
+    ]:
+      with self.assertRaisesRegex(sqlite3.OperationalError, error):
+        pluck(mapping)
+
+  def test_html_size(self):
+    a, b, c, d, e = db.execute("""select
+      html_size('<p>é</p>', 'p'),
+      html_size('<p>a</p>'),
+      html_size('<div><img src=x><br></div>', 'div'),
+      html_size('<p>a</p>', 'div'),
+      html_size(html_parse('<p>a</p>'), 'p')
+    """).fetchone()
+    self.assertEqual(a, 9)
+    self.assertEqual(b, 47)
+    self.assertEqual(c, 30)
+    self.assertEqual(d, None)
+    self.assertEqual(e, 8)
+
+  def test_html_offset(self):
+    doc = '<!DOCTYPE html>\n<p>é</p>\n<table><tr><td class="x">b</td></tr></table>'
+    a, b, c, d, e, f = db.execute("""select
+      html_offset(:doc, 'p'),
+      html_offset(:doc, '.x'),
+      html_offset(:doc, 'tbody'),
+      html_offset(:doc, 'div'),
+      html_offset(html_parse(:doc), 'td'),
+      html_offset(cast(:doc as blob), 'table')
+    """, {"doc": doc}).fetchone()
+    self.assertEqual(a, 16)
+    self.assertEqual(b, 37)
+    self.assertEqual(c, None)
+    self.assertEqual(d, None)
+    self.assertEqual(e, 37)
+    self.assertEqual(f, 26)
+    self.assertTrue(doc.encode()[b:].startswith(b'<td class="x">'))
+
+    # a stray </p> or content moved out of a table doesn't shift later offsets
+    a, b, c, d = db.execute("""select
+      html_offset('<div></p><span>a</span><p>b</p></div>', 'div > p:first-child'),
+      html_offset('<div></p><span>a</span><p>b</p></div>', 'span'),
+      html_offset('<table><tr><td>1</td></tr><div>x</div></table>', 'div'),
+      html_offset('<table><tr><td>1</td></tr><div>x</div></table>', 'td')
+    """).fetchone()
+    self.assertEqual(a, None)
+    self.assertEqual(b, 9)
+    self.assertEqual(c, 26)
+    self.assertEqual(d, 11)
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector"):
+      db.execute("select html_offset('<p>a</p>', '>>')").fetchone()
+
+  def test_html_tag(self):
+    a, b, c = db.execute("""select
+      html_tag('<div><a href="#">x</a></div>', '[href]'),
+      html_tag('<DIV class=x></DIV>', '.x'),
+      html_tag('<p>a</p>', 'span')
+    """).fetchone()
+    self.assertEqual(a, "a")
+    self.assertEqual(b, "div")
+    self.assertEqual(c, None)
+
   def test_html_count(self):
     a, b, c = db.execute("""select 
       html_count('<div> ', 'p'), 
@@ -175,6 +750,232 @@ class TestHtml(unittest.TestCase):
     self.assertEqual(b, 1)
     self.assertEqual(c, 2)
   
+  def test_html_count_stream(self):
+    doc = """<!doctype html>
+<html><head><title>t</title></head><body>
+<ul class=nav><li><a href="/a">a</a><li><a href="/b">b</a><li><a>c</a></ul>
+<p>one<p>two <a href="/d">d</a>
+<div><p>three</div>
+<svg><circle/><circle/></svg>
+</body></html>"""
+    table = "<table><tr><td>a<td>b<tr><th>c</table><table><thead><tr><th>h</thead><tr><td>x</table>"
+    fragment = "<title>t</title><p>a<script>x</script><div><p>b</div>"
+    for d in [doc, table, fragment]:
+      for selector in ['*', 'a', 'a[href]', 'li', 'ul > li', 'li:nth-child(2) a', 'p', 'div p', 'li + li', 'circle', 'body > p',
+                       'tbody tr', 'table > tbody > tr > td', 'thead th', 'body p', 'html *', 'head > title', 'body script']:
+        with self.subTest(doc=d, selector=selector):
+          expected, actual = db.execute("select html_count(?, ?), html_count_stream(?, ?)", [d, selector, d, selector]).fetchone()
+          self.assertEqual(actual, expected)
+
+    # markup that the parser repairs further than closing omitted end tags
+    repaired = [
+      "<head><template><li>a</li></template></head><body><p>b</p></body>",
+      "<image src=a.png>",
+      "<p>a<table><tr><td>b</td></tr></table>",
+      "<h1>a<h2>b</h2></h1>",
+      "<p><li>a",
+      "<button><p>a</button><p>b",
+      "<a>1<a>2</a></a>",
+      "<select><hr><option>a</select>",
+      "<p><b>a<p>b",
+      "<table><tr><td>1</td></tr><div>x</div></table>",
+      "<svg><foreignObject><p>a</p></foreignObject></svg>",
+    ]
+    for d in repaired:
+      for selector in ['*', 'body > *', 'template li', 'img', 'p', 'p > *', 'h1 h2', 'li', 'button p', 'a a', 'select *', 'hr', 'b', 'div', 'td']:
+        with self.subTest(doc=d, selector=selector):
+          expected, actual = db.execute("select html_count(?, ?), html_count_stream(?, ?)", [d, selector, d, selector]).fetchone()
+          self.assertEqual(actual, expected)
+
+    a, b = db.execute("""select
+      html_count_stream(html_parse('<p>a</p><p>b</p>'), 'p:last-child'),
+      html_count_stream('<dl><dt>a<dd>b<dt>c<dd>d</dl>', 'dt + dd')
+    """).fetchone()
+    self.assertEqual(a, 1)
+    self.assertEqual(b, 2)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "can't be matched while streaming"):
+      db.execute("select html_count_stream('<p>a</p>', 'p:has(b)')").fetchone()
+
+  def test_html_text_stream(self):
+    doc = """<!doctype html>
+<html>
+<head><title>T &lt;</title><script>if (a < b) {}</script></head>
+<body>
+<pre>
+x</pre><p>a &amp; <b>b</b><br>c</p>
+</body>
+</html>"""
+    expected, actual = db.execute("select html_text(?), html_text_stream(?)", [doc, doc]).fetchone()
+    self.assertEqual(actual, expected)
+    self.assertEqual(db.execute("select html_text_stream('  <p>a &amp; <b>b</b></p>')").fetchone()[0], "a & b")
+
+  def test_html_extract_between(self):
+    a, b, c, d, e = db.execute("""select
+      html_extract_between('<h2>Intro</h2><p>a</p> text <!--x--><p>b</p><h2>Usage</h2><p>c</p>', 'h2', 'h2'),
+      html_extract_between('<h2>Intro</h2><p>a</p><h2>Usage</h2><p>c</p>', 'h2:nth-of-type(2)', 'h2'),
+      html_extract_between('<div><h3>a</h3><p>b</p></div><h3>c</h3>', 'h3', 'h3'),
+      html_extract_between('<h2>a</h2><h2>b</h2>', 'h2', 'h2'),
+      html_extract_between('<p>a</p>', 'h2', 'h2')
+    """).fetchone()
+    self.assertEqual(a, "<p>a</p> text <!--x--><p>b</p>")
+    self.assertEqual(b, "<p>c</p>")
+    self.assertEqual(c, "<p>b</p>")
+    self.assertEqual(d, None)
+    self.assertEqual(e, None)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector"):
+      db.execute("select html_extract_between('<p>a</p>', 'p', '>>')").fetchone()
+
+  def test_html_extract_first(self):
+    a, b, c, d, e, f = db.execute("""select
+      html_extract_first('<div class="price-new">$5</div>', '.price', '.price-new', '[itemprop=price]'),
+      html_extract_first('<p>a</p><h1>b</h1>', 'h1', 'p'),
+      html_extract_first('<p>a</p>', 'h1', 'h2'),
+      html_extract_first('<p>a</p>', 'p'),
+      html_extract_first(html_parse('<p>a</p><p>b</p>'), '', null, 'p:last-child'),
+      html_extract_first('<p>a</p>', 'p', '>>')
+    """).fetchone()
+    self.assertEqual(a, '<div class="price-new">$5</div>')
+    self.assertEqual(b, "<h1>b</h1>")
+    self.assertEqual(c, None)
+    self.assertEqual(d, "<p>a</p>")
+    self.assertEqual(e, "<p>b</p>")
+    self.assertEqual(f, "<p>a</p>")
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector"):
+      db.execute("select html_extract_first('<p>a</p>', '>>', 'p')").fetchone()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "at least one selector"):
+      db.execute("select html_extract_first('<p>a</p>')").fetchone()
+
+  def test_html_outer_all(self):
+    a, b, c, d = db.execute("""select
+      html_outer_all('<p>a</p><div><p class="x">b &amp; c</p></div>', 'p'),
+      html_outer_all('<p>a</p>', 'span'),
+      (select json_group_array(value) from json_each(html_outer_all('<ul><li>1</li><li>2<ul><li>3</li></ul></li></ul>', 'li'))),
+      json_array_length(html_outer_all('<p>a</p><p>b</p>', 'p'))
+    """).fetchone()
+    self.assertEqual(a, '["<p>a</p>","<p class=\\"x\\">b &amp; c</p>"]')
+    self.assertEqual(b, "[]")
+    self.assertEqual(c, '["<li>1</li>","<li>2<ul><li>3</li></ul></li>","<li>3</li>"]')
+    self.assertEqual(d, 2)
+
+  def test_html_find_text(self):
+    a, b, c, d = db.execute("""select
+      html_find_text('<h2>Intro</h2><h2>Pricing <i>plans</i></h2>', 'h2', '^pricing', 'i'),
+      html_find_text('<h2>Intro</h2><h2>Pricing</h2>', 'h2', '^pricing'),
+      html_find_text('<table><tr><td>#5</td><td>Order #1234</td></tr></table>', 'td', '#\\d{2,}'),
+      html_find_text('<p>a</p>', 'p', 'a', '')
+    """).fetchone()
+    self.assertEqual(a, "<h2>Pricing <i>plans</i></h2>")
+    self.assertEqual(b, None)
+    self.assertEqual(c, "<td>Order #1234</td>")
+    self.assertEqual(d, "<p>a</p>")
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "error parsing regexp"):
+      db.execute("select html_find_text('<p>a</p>', 'p', '(a')").fetchone()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "unknown regexp flag"):
+      db.execute("select html_find_text('<p>a</p>', 'p', 'a', 'x')").fetchone()
+
+  def test_html_find_attr_regex(self):
+    a, b, c, d = db.execute("""select
+      html_find_attr_regex('<a href="/about">a</a><a>x</a><a href="/p/1234-shoe">b</a><a href="/p/5-hat">c</a>', 'a', 'href', '^/p/\\d+-'),
+      html_find_attr_regex('<img src="a.PNG"><img src="b.jpg">', 'img', 'src', '\\.png$', 'i'),
+      html_find_attr_regex('<img src="a.PNG">', 'img', 'src', '\\.png$'),
+      html_find_attr_regex('<p data-x="">a</p>', 'p', 'data-x', '^$')
+    """).fetchone()
+    self.assertEqual(a, '<a href="/p/1234-shoe">b</a>')
+    self.assertEqual(b, '<img src="a.PNG"/>')
+    self.assertEqual(c, None)
+    self.assertEqual(d, '<p data-x="">a</p>')
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "error parsing regexp"):
+      db.execute("select html_find_attr_regex('<p>a</p>', 'p', 'id', '(a')").fetchone()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "unknown regexp flag"):
+      db.execute("select html_find_attr_regex('<p>a</p>', 'p', 'id', 'a', 'x')").fetchone()
+
+  def test_html_count_agg(self):
+    rows = db.execute("""select site, html_count_agg(content, selector)
+    from (
+      select 'a' as site, '<p>1</p><p>2</p>' as content, 'p' as selector
+      union all select 'a', '<div><p>3</p></div>', 'p'
+      union all select 'a', null, 'p'
+      union all select 'b', '<p>1</p><b>2</b>', 'b'
+      union all select 'b', '<p><b>3</b></p>', 'p, b'
+    )
+    group by site
+    order by site
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [("a", 3), ("b", 3)])
+
+    a, b = db.execute("""select
+      (select html_count_agg(content, 'p') from (select '<p>a</p>' as content where 0)),
+      (select html_count_agg(null, 'p'))
+    """).fetchone()
+    self.assertEqual(a, 0)
+    self.assertEqual(b, 0)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector"):
+      db.execute("select html_count_agg('<p>a</p>', 'p[')").fetchone()
+
+  def test_html_count_distinct_text(self):
+    a, b, c = db.execute("""select
+      html_count_distinct_text('<a>Home</a> <a> Home </a> <a>home</a> <a>About <b>us</b></a> <a>About  us</a>', 'a'),
+      html_count_distinct_text('<a></a><a> </a>', 'a'),
+      html_count_distinct_text('<p>a</p>', 'a')
+    """).fetchone()
+    self.assertEqual(a, 3)
+    self.assertEqual(b, 1)
+    self.assertEqual(c, 0)
+
+  def test_html_depth(self):
+    a, b, c, d = db.execute("""select
+      html_depth('<div><p><b>a</b></p><p>b</p></div>', 'div'),
+      html_depth('<div><p><b>a</b></p></div>'),
+      html_depth('<div>text</div>', 'div'),
+      html_depth('<div></div>', 'p')
+    """).fetchone()
+    self.assertEqual(a, 3)
+    self.assertEqual(b, 5)
+    self.assertEqual(c, 1)
+    self.assertEqual(d, None)
+
+  def test_html_parse(self):
+    a, b, c, d = db.execute("""select
+      html_parse('<p>a</p>'),
+      html_text(html_parse('<p>a</p><b>b</b>'), 'b'),
+      html_remove(html_parse('<p>a</p><script>x</script>'), 'script'),
+      html_count(html_parse('<p>a</p><p>b</p>'), 'p')
+    """).fetchone()
+    # handles are only visible to sqlite-html functions
+    self.assertEqual(a, None)
+    self.assertEqual(b, "b")
+    self.assertEqual(c, "<p>a</p>")
+    self.assertEqual(d, 2)
+
+    rows = db.execute("select text from html_each(html_parse('<p>a</p><p>b</p>'), 'p')").fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["a", "b"])
+
+  def test_html_each_json(self):
+    a, b, c = db.execute("""select
+      html_each_json('<p class="x y" id=a> b </p><p>c</p>', 'p'),
+      html_each_json('<p>', 'a'),
+      (select json_group_array(json_extract(value, '$.attrib.href')) from json_each(html_each_json('<a href="/1">1</a><a href="/2">2</a>', 'a')))
+    """).fetchone()
+    self.assertEqual(json.loads(a), [
+      {"tag": "p", "text": " b ", "class": "x y", "attrib": {"class": "x y", "id": "a"}},
+      {"tag": "p", "text": "c", "class": None, "attrib": {}},
+    ])
+    self.assertEqual(b, "[]")
+    self.assertEqual(c, '["/1","/2"]')
+
+  def test_html_each_json_attrib_whitespace(self):
+    a = db.execute(
+      "select html_each_json(?, 'p')",
+      ['<p title="  a  b\n\tc " data-x=" ">x</p>']
+    ).fetchone()[0]
+    self.assertEqual(json.loads(a)[0]["attrib"], {"title": "  a  b\n\tc ", "data-x": " "})
+
   def test_html_each(self):
     rows = db.execute("""select rowid, * 
     from html_each('<div>
@@ -185,11 +986,845 @@ class TestHtml(unittest.TestCase):
     """).fetchall()
 
     self.assertEqual(list(map(lambda x: dict(x), rows)), [
-      {"rowid":0,"html":"<p>a</p>","text":"a"},
-      {"rowid":1,"html":"<p id=\"x\">b</p>","text":"b"},
-      {"rowid":2,"html":"<p>c1<span>c2</span></p>","text":"c1c2"}
+      {"rowid":0,"html":"<p>a</p>","text":"a","value":None,"child_count":0,"line":2,"is_visible":1,"attrib_count":0,"tag":"p","text_norm":"a","is_void":0,"qname":"p","signature":"p","own_text":"a","unique_css":"html > body:nth-child(2) > div:nth-child(1) > p:nth-child(1)","attr_value":None,"byte_size":8,"match_index":0,"checked":0,"disabled":0,"selected":0,"hidden":0,"required":0,"is_foreign":0,"ancestor_classes":"[[],[],[],[]]"},
+      {"rowid":1,"html":"<p id=\"x\">b</p>","text":"b","value":None,"child_count":0,"line":3,"is_visible":1,"attrib_count":1,"tag":"p","text_norm":"b","is_void":0,"qname":"p","signature":"p#x","own_text":"b","unique_css":"html > body:nth-child(2) > div:nth-child(1) > p:nth-child(2)","attr_value":None,"byte_size":15,"match_index":1,"checked":0,"disabled":0,"selected":0,"hidden":0,"required":0,"is_foreign":0,"ancestor_classes":"[[],[],[],[]]"},
+      {"rowid":2,"html":"<p>c1<span>c2</span></p>","text":"c1c2","value":None,"child_count":1,"line":4,"is_visible":1,"attrib_count":0,"tag":"p","text_norm":"c1c2","is_void":0,"qname":"p","signature":"p","own_text":"c1","unique_css":"html > body:nth-child(2) > div:nth-child(1) > p:nth-child(3)","attr_value":None,"byte_size":24,"match_index":2,"checked":0,"disabled":0,"selected":0,"hidden":0,"required":0,"is_foreign":0,"ancestor_classes":"[[],[],[],[]]"}
     ])
+
+  def test_html_each_selector_errors(self):
+    for selector in ["", "   "]:
+      rows = db.execute("select * from html_each('<p>a</p>', ?)", [selector]).fetchall()
+      self.assertEqual(rows, [])
+      rows = db.execute("select * from html_children('<p>a</p>', ?)", [selector]).fetchall()
+      self.assertEqual(rows, [])
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector \"p\\[\""):
+      db.execute("select * from html_each('<p>a</p>', 'p[')").fetchall()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector"):
+      db.execute("select * from html_children('<p>a</p>', '>>')").fetchall()
+
+  def test_html_children(self):
+    rows = db.execute("""select text
+    from html_children('<ul>
+      <li>a</li>
+      <li>b <ul><li>nested</li></ul></li>
+      <li>c</li>
+    </ul>', 'li')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["a", "b nested", "c"])
+
+    rows = db.execute("""select text
+    from html_children(html_extract('<div><ul><li>a<ul><li>b</li></ul></li></ul></div>', 'ul'), 'li')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["ab"])
+
+  def test_html_children_root_inclusive(self):
+    texts = lambda sql: list(map(lambda x: x[0], db.execute(sql).fetchall()))
+    self.assertEqual(texts("select text from html_children('<li>a</li>', 'li')"), [])
+    self.assertEqual(texts("select text from html_children('<li>a</li>', 'li', 0)"), [])
+    self.assertEqual(texts("select text from html_children('<li>a</li>', 'li', 1)"), ["a"])
+    self.assertEqual(
+      texts("select text from html_children('<li>a<ul><li>b<ol><li>c</li></ol></li></ul></li><li>d</li><p>e</p>', 'li', 1)"),
+      ["abc", "d"]
+    )
+    self.assertEqual(
+      texts("select text from html_children('<ul><li>a</li></ul><li>b</li>', 'li', 1)"),
+      ["a", "b"]
+    )
+    self.assertEqual(texts("select text from html_each('<li>a</li>', 'li', 1)"), ["a"])
+
+  def test_html_select_options(self):
+    rows = db.execute("""select *
+    from html_select_options('<select id=a><option>x</option></select>
+    <select id=b>
+      <option value="s">Small</option>
+      <option selected>
+        Medium  size
+      </option>
+      <optgroup label="Big" disabled>
+        <option value="l" label="L">Large</option>
+      </optgroup>
+    </select>', '#b')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: dict(x), rows)), [
+      {"value":"s","label":"Small","selected":0,"disabled":0},
+      {"value":"Medium size","label":"Medium size","selected":1,"disabled":0},
+      {"value":"l","label":"L","selected":0,"disabled":1},
+    ])
+
+    rows = db.execute("select * from html_select_options('<p>a</p>', 'select')").fetchall()
+    self.assertEqual(rows, [])
+
+    disabled = lambda doc: list(map(lambda x: x[0], db.execute("select disabled from html_select_options(?, 'select')", [doc]).fetchall()))
+    self.assertEqual(disabled('<div disabled><select><option>a</option><option disabled>b</option></select></div>'), [0, 1])
+    self.assertEqual(disabled('<fieldset disabled><select><option>a</option></select></fieldset>'), [0])
+    self.assertEqual(disabled('<select disabled><option>a</option><optgroup><option>b</option></optgroup></select>'), [1, 1])
+
+  def test_html_scripts(self):
+    rows = db.execute("""select *
+    from html_scripts('<head>
+      <script src="/app.js" defer></script>
+      <script type="module" async src="m.js">ignored</script>
+    </head>
+    <body><script>console.log("hi")</script></body>')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: dict(x), rows)), [
+      {"index":0,"src":"/app.js","type":None,"async":0,"defer":1,"body":None},
+      {"index":1,"src":"m.js","type":"module","async":1,"defer":0,"body":None},
+      {"index":2,"src":None,"type":None,"async":0,"defer":0,"body":"console.log(\"hi\")"},
+    ])
+
+    rows = db.execute("""select "index", src from html_scripts('<script src=a.js></script><script src=b.js></script>') where "index" > 0""").fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [(1, "b.js")])
+
+    rows = db.execute("select * from html_scripts('<p>a</p>')").fetchall()
+    self.assertEqual(rows, [])
+
+  def test_html_styles(self):
+    rows = db.execute("""select *
+    from html_styles('<head>
+      <link rel="stylesheet" href="/main.css">
+      <link rel="icon" href="/favicon.ico">
+      <style media="print">nav { display: none }</style>
+    </head>
+    <body><link rel="Alternate StyleSheet" href="alt.css" media="screen"></body>')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: dict(x), rows)), [
+      {"index":0,"kind":"external","href":"/main.css","media":None,"body":None},
+      {"index":1,"kind":"inline","href":None,"media":"print","body":"nav { display: none }"},
+      {"index":2,"kind":"external","href":"alt.css","media":"screen","body":None},
+    ])
+
+    rows = db.execute("select * from html_styles('<p>a</p>')").fetchall()
+    self.assertEqual(rows, [])
+
+  def test_html_each_child_count(self):
+    rows = db.execute("""select child_count
+    from html_each('<ul>
+      <li>text only</li>
+      <li>a <b>b</b> c <i>d</i></li>
+    </ul>', 'ul, li')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), [2, 0, 2])
+
+  def test_html_each_is_visible(self):
+    rows = db.execute("""select text, is_visible
+    from html_each('<p>a</p>
+      <p hidden>b</p>
+      <div style="color: red; DISPLAY : none !important"><p>c</p></div>
+      <p style="visibility:hidden">d</p>
+      <p style="display: block">e</p>
+      <template><p>f</p></template>
+      <input type=HIDDEN value=g>
+      <input value=h>', 'p, input')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("a", 1), ("b", 0), ("c", 0), ("d", 0), ("e", 1), ("f", 0), (None, 0), (None, 1),
+    ])
+
+  def test_html_each_attrib_count(self):
+    doc = '<p>a</p><p id=b>b</p><p id=c class=c>c</p>'
+    rows = db.execute("select text, attrib_count from html_each(?, 'p')", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [("a", 0), ("b", 1), ("c", 2)])
+
+    texts = lambda where: list(map(lambda x: x[0], db.execute(
+      "select text from html_each(?, 'p') where " + where, [doc]
+    ).fetchall()))
+    self.assertEqual(texts("attrib_count > 0"), ["b", "c"])
+    self.assertEqual(texts("attrib_count >= 2"), ["c"])
+    self.assertEqual(texts("attrib_count = 0"), ["a"])
+    self.assertEqual(texts("attrib_count > -0.5"), ["a", "b", "c"])
+    self.assertEqual(texts("attrib_count < 2"), ["a", "b"])
+
+  def test_html_each_text_norm(self):
+    rows = db.execute("""select text, text_norm
+    from html_each('<ul>
+      <li>
+        a   <b>b</b>
+        c
+      </li>
+      <li></li>
+    </ul>', 'li')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("\n        a   b\n        c\n      ", "a b c"),
+      (None, None),
+    ])
+
+  def test_html_each_is_void(self):
+    rows = db.execute("""select tag, is_void
+    from html_each('<p>a<br>b<img src=x><input></p><hr><svg><circle/></svg><textarea></textarea>', 'body *')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("p", 0),
+      ("br", 1),
+      ("img", 1),
+      ("input", 1),
+      ("hr", 1),
+      ("svg", 0),
+      ("circle", 0),
+      ("textarea", 0),
+    ])
+
+  def test_html_each_qname(self):
+    rows = db.execute("""select tag, qname
+    from html_each('<svg:rect></svg:rect><og:Image></og:Image><svg><rect/><foreignObject><p>a</p></foreignObject></svg><math><mi>x</mi></math>', 'body *')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("svg:rect", "svg:rect"),
+      ("og:image", "og:image"),
+      ("svg", "svg:svg"),
+      ("rect", "svg:rect"),
+      ("foreignObject", "svg:foreignObject"),
+      ("p", "p"),
+      ("math", "math:math"),
+      ("mi", "math:mi"),
+    ])
+
+  def test_html_each_max_rows(self):
+    doc = '<p>a</p><p class=x>b</p><p class=x>c</p><p>d</p>'
+    texts = lambda sql, *args: list(map(lambda x: x[0], db.execute(sql, [doc, *args]).fetchall()))
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, 2)"), ["a", "b"])
+    self.assertEqual(texts("select text from html_each(?, 'p') where max_rows = 3"), ["a", "b", "c"])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, ?)", 0), [])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, ?)", 10), ["a", "b", "c", "d"])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, ?)", -1), ["a", "b", "c", "d"])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, ?)", None), ["a", "b", "c", "d"])
+    # max_rows counts selector matches, whether or not SQLite passes the other constraints to html_each
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, 1) where attrib_count > 0"), [])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, 1) where attrib_count > 0 or text = 'z'"), [])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, 3) where attrib_count > 0"), ["b", "c"])
+    self.assertEqual(texts("select text from html_each(?, 'p', 0, 3) where attrib_count != 0"), ["b", "c"])
+    self.assertEqual(texts("select text from html_children(?, 'p', 1, 3)"), ["a", "b", "c"])
+
+  def test_html_each_ancestor_classes(self):
+    rows = db.execute("""select text, ancestor_classes, json_array_length(ancestor_classes)
+    from html_each('<div class="page  dark"><ul class><li class="item">a<b>b</b></li></ul></div>', 'li, b')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("ab", '[[],[],["page","dark"],[],["item"]]', 5),
+      ("b", '[[],[],["page","dark"],[],["item"],[]]', 6),
+    ])
+    self.assertEqual(db.execute("select ancestor_classes from html_each('<p>a</p>', 'html')").fetchone()[0], "[[]]")
+
+  def test_html_each_attr_value(self):
+    doc = '<p><a href="/a">a</a><a>b</a><a href="">c</a></p>'
+    rows = lambda sql: list(map(lambda x: tuple(x), db.execute(sql, [doc]).fetchall()))
+    self.assertEqual(rows("select text, attr_value from html_each(?, 'a') where attr_name = 'href'"), [
+      ("a", "/a"), ("b", None), ("c", None),
+    ])
+    self.assertEqual(rows("select attr_name, attr_value from html_each(?, 'a', 0, 1, null, 'href')"), [("href", "/a")])
+    self.assertEqual(rows("select attr_value from html_each(?, 'a:not([href])')"), [(None,)])
+    self.assertEqual(rows("select attr_value from html_children(?, 'a') where attr_name = 'href'"), [("/a",), (None,), (None,)])
+    self.assertEqual(rows("select attr_value from html_children(?, 'a') where attr_name = 'HREF'"), [(None,), (None,), (None,)])
+
+  def test_html_each_boolean_attributes(self):
+    rows = db.execute("""select checked, disabled, selected, hidden, required
+    from html_each('<form>
+      <input type=checkbox checked>
+      <input disabled="false" required="">
+      <select><option selected hidden>a</option></select>
+      <fieldset disabled><input></fieldset>
+    </form>', 'input, option')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      (1, 0, 0, 0, 0),
+      (0, 1, 0, 0, 1),
+      (0, 0, 1, 1, 0),
+      (0, 0, 0, 0, 0),
+    ])
+
+  def test_html_each_byte_size(self):
+    rows = db.execute("""select html, byte_size, length(cast(html as blob))
+    from html_each('<div><p>é</p><img src=a.png><ul><li>a</li><li>b</li></ul></div>', '*')
+    order by byte_size desc
+    """).fetchall()
+    self.assertEqual([x[1] for x in rows], [x[2] for x in rows])
+    self.assertEqual([x[1] for x in rows], [67, 29, 18, 9, 9, 9])
+
+  def test_html_each_columns(self):
+    # every column, hidden or not, is handled by the cursor instead of hitting its unknown column guard
+    columns = [row[1] for row in db.execute("select * from pragma_table_xinfo('html_each')").fetchall()]
+    self.assertIn("byte_size", columns)
+    self.assertIn("attr_name", columns)
+    self.assertIn("path_root", columns)
+    self.assertIn("is_foreign", columns)
+    self.assertIn("ancestor_classes", columns)
+    for table in ["html_each", "html_children"]:
+      for column in columns:
+        with self.subTest(table=table, column=column):
+          rows = db.execute(f"select {column} from {table}('<div><p>a</p></div>', 'p', 1)").fetchall()
+          self.assertEqual(len(rows), 1)
+
+  def test_html_each_context(self):
+    doc = '<nav><a>a</a><div><a>b</a></div><button>c</button></nav><a>d</a><aside><a>e</a></aside>'
+    texts = lambda sql, *args: list(map(lambda x: x[0], db.execute(sql, [doc, *args]).fetchall()))
+    self.assertEqual(texts("select text from html_each(?, 'a') where context = 'nav'"), ["a", "b"])
+    self.assertEqual(texts("select text from html_each(?, 'a, button', 0, -1, 'nav')"), ["a", "b", "c"])
+    self.assertEqual(texts("select text from html_each(?, 'a') where context = 'nav, nav div, aside'"), ["a", "b", "e"])
+    self.assertEqual(texts("select text from html_each(?, 'a') where context = 'main'"), [])
+    self.assertEqual(texts("select text from html_each(?, 'a', 0, 1, 'nav')"), ["a"])
+    self.assertEqual(texts("select text from html_each(?, 'a', 0, null, null)"), ["a", "b", "d", "e"])
+    self.assertEqual(texts("select text from html_each(?, 'a, div', 1, null, 'nav > div')"), ["b", "b"])
+    self.assertEqual(texts("select text from html_each(?, 'nav, a', 1, null, 'nav, aside')"), ["abc", "a", "b", "e"])
+    self.assertEqual(texts("select text from html_each(?, 'a', 1)"), ["a", "b", "d", "e"])
+    self.assertEqual(texts("select text from html_children(?, 'a') where context = 'nav'"), ["a"])
+    self.assertEqual(texts("select text from html_children(?, 'a, nav > div', 1, null, 'nav > div')"), ["b", "b"])
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "context: invalid selector"):
+      db.execute("select * from html_each('<p>a</p>', 'p') where context = '>>'").fetchall()
+
+  def test_html_each_is_foreign(self):
+    rows = db.execute("""select qname, is_foreign
+    from html_each('<p>a</p><svg><rect/><foreignObject><div>b</div></foreignObject></svg><math><mi>x</mi></math><svg:rect>', '*')
+    where tag not in ('html', 'head', 'body')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("p", 0),
+      ("svg:svg", 1),
+      ("svg:rect", 1),
+      ("svg:foreignObject", 1),
+      ("div", 0),
+      ("math:math", 1),
+      ("math:mi", 1),
+      ("svg:rect", 0),
+    ])
+
+  def test_html_each_match_index(self):
+    doc = '<ul><li>a</li><li>b</li></ul><ol><li>c</li></ol>'
+    rows = db.execute("select text, match_index from html_each(?, 'li')", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [("a", 0), ("b", 1), ("c", 2)])
+    rows = db.execute("select text from html_each(?, 'li') where match_index = 2", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["c"])
+    rows = db.execute("select match_index from html_each(?, 'li') where context = 'ol'", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), [0])
+    rows = db.execute("select text, match_index from html_each('<div><a>1</a><b>2</b><a>3</a></div>', 'div *') where tag = 'a'").fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [("1", 0), ("3", 2)])
+
+  def test_html_each_own_text(self):
+    rows = db.execute("""select text, own_text
+    from html_each('<div>hi <b>bye</b></div><label>Name: <input> <i>(required)</i><!-- x --></label><p><b>a</b></p>', 'div, label, p')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("hi bye", "hi "),
+      ("Name:  (required)", "Name:  "),
+      ("a", None),
+    ])
+
+  def test_html_each_signature(self):
+    rows = db.execute("""select signature
+    from html_each('<div id="main" class="x"><p class="a  b">a</p><p id="">b</p><svg><rect class="r"/></svg></div>', 'div *')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["p.a.b", "p", "svg", "rect.r"])
+    rows = db.execute("""select signature, count(*)
+    from html_each('<ul><li class=a>1</li><li class=a>2</li><li>3</li></ul>', 'li') group by 1 order by 1
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [("li", 1), ("li.a", 2)])
+
+  def test_html_each_unique_css(self):
+    doc = """<!DOCTYPE html><html><head><title>t</title></head><body>
+    <ul><li>a</li><!-- x --><li>b <b>c</b></li></ul>
+    <ul><li>a</li><li>b <b>c</b></li></ul>
+    <svg><linearGradient id=g></linearGradient></svg>
+    </body></html>"""
+    rows = db.execute("select html, unique_css from html_each(?, '*')", [doc]).fetchall()
+    self.assertEqual(rows[0][1], "html")
+    self.assertEqual(rows[1][1], "html > head:nth-child(1)")
+    self.assertEqual(rows[6][1], "html > body:nth-child(2) > ul:nth-child(1) > li:nth-child(2)")
+    self.assertEqual(rows[-1][1], "html > body:nth-child(2) > svg:nth-child(3) > *:nth-child(1)")
+    for html, unique_css in rows:
+      with self.subTest(unique_css=unique_css):
+        self.assertEqual(db.execute("select html_count(?, ?)", [doc, unique_css]).fetchone()[0], 1)
+        self.assertEqual(db.execute("select html_extract(?, ?)", [doc, unique_css]).fetchone()[0], html)
+
+    doc = '<main><p>a</p><div class="card"><h2>b</h2><p>c <b>d</b></p></div><div class="card"><p>e</p></div></main>'
+    rows = db.execute("select unique_css from html_each(?, 'p, b') where path_root = '.card'", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), [
+      "html > body:nth-child(2) > main:nth-child(1) > p:nth-child(1)",
+      "div > p:nth-child(2)",
+      "div > p:nth-child(2) > b:nth-child(1)",
+      "div > p:nth-child(1)",
+    ])
+    rows = db.execute("select unique_css from html_each(?, '.card', 0, null, null, null, 'main, .card')", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["main > div:nth-child(2)", "main > div:nth-child(3)"])
+    rows = db.execute("select unique_css from html_children(?, 'main') where path_root = 'main'", [doc]).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["html > body:nth-child(2) > main:nth-child(1)"])
+    card = db.execute("select html_extract(?, '.card')", [doc]).fetchone()[0]
+    self.assertEqual(db.execute("select html_text(?, 'div > p:nth-child(2)')", [card]).fetchone()[0], "c d")
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "path_root: invalid selector"):
+      db.execute("select * from html_each('<p>a</p>', 'p') where path_root = '>>'").fetchall()
+
+  def test_html_each_tag(self):
+    doc = '<div><a href=x>a</a><p>b</p><a>c</a><svg><foreignObject>d</foreignObject></svg></div>'
+    texts = lambda where: list(map(lambda x: x[0], db.execute(
+      "select text from html_each(?, '*') where " + where, [doc]
+    ).fetchall()))
+    self.assertEqual(texts("tag = 'a'"), ["a", "c"])
+    self.assertEqual(texts("tag = 'A'"), [])
+    self.assertEqual(texts("tag = 'foreignObject'"), ["d"])
+    self.assertEqual(texts("tag = 'a' and attrib_count > 0"), ["a"])
+    self.assertEqual(sorted(texts("tag in ('p', 'a')")), ["a", "b", "c"])
+    self.assertEqual(texts("tag = 1"), [])
+
+  def test_html_each_line(self):
+    rows = db.execute("""select line
+    from html_each('<div>
+<p>a</p>
+
+<p>b</p>
+<table><tr><td>c</td></tr></table>
+</div>', 'p, tbody, td')
+    """).fetchall()
+    # tbody is implied by the parser, so it has no line in the source
+    self.assertEqual(list(map(lambda x: x[0], rows)), [2, 4, None, 5])
+
+    # elements the parser adds or moves don't take the lines of later start tags
+    rows = db.execute("""select tag, line
+    from html_each('<div></p>
+<span>a</span>
+<p>b</p></div>
+<table><tr><td>1</td></tr>
+<div>x</div></table>
+<image src=a.png>', 'body *')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: tuple(x), rows)), [
+      ("div", 1), ("p", None), ("span", 2), ("p", 3),
+      ("div", 5), ("table", 4), ("tbody", None), ("tr", 4), ("td", 4),
+      ("img", 6),
+    ])
+
+  def test_html_each_value(self):
+    rows = db.execute("""select value
+    from html_each('<form>
+    <input name=a value=x>
+    <input name=b>
+    <input type=checkbox name=c value=y checked>
+    <input type=checkbox name=d value=z>
+    <input type=radio name=e checked>
+    <textarea name=f>hello</textarea>
+    <select name=g><option value=1>one<option value=2 selected>two</select>
+    <select name=h><option> three </option></select>
+    </form>', '[name]')
+    """).fetchall()
+    self.assertEqual(list(map(lambda x: x[0], rows)), ["x", None, "y", None, "on", "hello", "2", "three"])
     
+  def test_html_remove(self):
+    a, b, c = db.execute("""select
+      html_remove('<div><script>alert(1)</script><p>a</p><script src="x.js"></script></div>', 'script'),
+      html_remove('<p>a</p><b>b</b><i>c</i>', 'b, i'),
+      html_remove('<html><head><script>x</script></head><body><p>a</p></body></html>', 'script')
+    """).fetchone()
+    self.assertEqual(a, "<div><p>a</p></div>")
+    self.assertEqual(b, "<p>a</p>")
+    self.assertEqual(c, "<html><head></head><body><p>a</p></body></html>")
+
+    # only real <html>, <head>, and <body> tags make the result a full document
+    self.assertEqual(tuple(db.execute("""select
+      html_remove('<header><script>x</script></header>', 'script'),
+      html_remove('<p title="<body>">a<!-- <html> --></p><script>"<head>"</script>', 'script'),
+      html_remove('<!DOCTYPE html><p>a</p><b>b</b>', 'b')
+    """).fetchone()), ("<header></header>", '<p title="&lt;body&gt;">a<!-- <html> --></p>', "<!DOCTYPE html><html><head></head><body><p>a</p></body></html>"))
+
+  def test_html_strip(self):
+    page = """<nav><ul><li>Home</li><li>About us</li></ul></nav>
+      <article><h1>Title</h1><p>First long paragraph here.</p><script>var x = 'a long script here';</script><p>Second.</p></article>
+      <aside><p>Short ad text</p></aside>"""
+    a, b, c, d, e, f, g = db.execute("""select
+      html_strip('<nav><a class=ad>x</a></nav><p>a</p><div class=ad>y</div><footer>z</footer>', 'nav, .ad, footer'),
+      html_strip('<p>a</p>', 'b'),
+      html_strip('<p>a</p>', 'b', 0),
+      html_strip(:page, 'script', 1),
+      html_strip('<div><p>a</p><p>b</p></div><p>c</p>', 'div', 1),
+      html_strip('<div><p>a</p></div><p>b</p>', 'p', 1),
+      html_strip(html_parse(:page), 'article', 1)
+    """, {"page": page}).fetchone()
+    self.assertEqual(a, "<p>a</p>")
+    self.assertEqual(b, "<p>a</p>")
+    self.assertEqual(c, "<p>a</p>")
+    self.assertEqual(d, "<article><h1>Title</h1><p>First long paragraph here.</p><p>Second.</p></article>")
+    self.assertEqual(e, "<p>c</p>")
+    self.assertEqual(f, None)
+    self.assertEqual(g, "<aside><p>Short ad text</p></aside>")
+
+  def test_html_replace(self):
+    a, b, c, d = db.execute("""select
+      html_replace('<p>a <img src="x.png"> b <img src="y.png"></p>', 'img', '[image]'),
+      html_replace('<p>a <b>b</b></p>', 'b', '<i>c</i>'),
+      html_replace('<p>a <b>b</b></p>', 'b', ''),
+      html_replace('<p>a <b>b</b></p>', 'b', '<i>unclosed')
+    """).fetchone()
+    self.assertEqual(a, "<p>a [image] b [image]</p>")
+    self.assertEqual(b, "<p>a <i>c</i></p>")
+    self.assertEqual(c, "<p>a </p>")
+    self.assertEqual(d, "<p>a <i>unclosed</i></p>")
+
+  def test_html_set_attr(self):
+    a, b, c = db.execute("""select
+      html_set_attr('<a href="/a">a</a><a href="/b" target="_self">b</a>', 'a', 'target', '_blank'),
+      html_set_attr('<a href="/a" rel="x">a</a><p rel="y">', 'a', 'rel', 'nofollow'),
+      html_set_attr('<a href="/a" target="_self">a</a>', 'a', 'target', null)
+    """).fetchone()
+    self.assertEqual(a, "<a href=\"/a\" target=\"_blank\">a</a><a href=\"/b\" target=\"_blank\">b</a>")
+    self.assertEqual(b, "<a href=\"/a\" rel=\"nofollow\">a</a><p rel=\"y\"></p>")
+    self.assertEqual(c, "<a href=\"/a\">a</a>")
+
+  def test_html_add_class(self):
+    a, b = db.execute("""select
+      html_add_class('<p>a</p><p class="x">b</p>', 'p', 'x y'),
+      html_add_class('<p>a</p><b>b</b>', 'b', 'bold')
+    """).fetchone()
+    self.assertEqual(a, "<p class=\"x y\">a</p><p class=\"x y\">b</p>")
+    self.assertEqual(b, "<p>a</p><b class=\"bold\">b</b>")
+
+  def test_html_remove_class(self):
+    a, b = db.execute("""select
+      html_remove_class('<p class="x y z">a</p>', 'p', 'x z'),
+      html_remove_class('<p class="x">a</p><b class="x">b</b>', 'b', 'x')
+    """).fetchone()
+    self.assertEqual(a, "<p class=\"y\">a</p>")
+    self.assertEqual(b, "<p class=\"x\">a</p><b>b</b>")
+
+  def test_html_wrap(self):
+    a, b = db.execute("""select
+      html_wrap('<p>a</p><p>b</p>', 'p', '<div class="x"></div>'),
+      html_wrap('<img src="a.png">', 'img', '<figure><a href="#"></a></figure>')
+    """).fetchone()
+    self.assertEqual(a, "<div class=\"x\"><p>a</p></div><div class=\"x\"><p>b</p></div>")
+    self.assertEqual(b, "<figure><a href=\"#\"><img src=\"a.png\"/></a></figure>")
+
+  def test_html_unwrap(self):
+    a, b = db.execute("""select
+      html_unwrap('<div><span><b>a</b> c</span></div>', 'b'),
+      html_unwrap('<p>a</p>', 'p')
+    """).fetchone()
+    self.assertEqual(a, "<div><b>a</b> c</div>")
+    self.assertEqual(b, "<p>a</p>")
+
+  def test_html_equal(self):
+    a, b, c, d, e, f = db.execute("""select
+      html_equal('<ul><li id=a class=b>One<li>Two<br></ul>', '<html><body><ul>
+  <li class="b" id="a">One</li>
+  <li>Two<br/></li>
+</ul></body></html>'),
+      html_equal('<p>One</p>', '<p>one</p>'),
+      html_equal('<b>a</b> <i>b</i>', '<b>a</b><i>b</i>'),
+      html_equal('<p>a<!-- x --></p>', '<p>a</p>'),
+      html_equal('<pre>a  b</pre>', '<pre>a b</pre>'),
+      html_equal(html_parse('<p>a</p>'), '<p>a  </p>')
+    """).fetchone()
+    self.assertEqual(a, 1)
+    self.assertEqual(b, 0)
+    self.assertEqual(c, 0)
+    self.assertEqual(d, 0)
+    self.assertEqual(e, 0)
+    self.assertEqual(f, 1)
+
+    # non-breaking spaces render differently, so they're kept instead of collapsed
+    g, h = db.execute("""select
+      html_equal('<p>a&nbsp;b</p>', '<p>a b</p>'),
+      html_normalize('<p> &nbsp; </p>')
+    """).fetchone()
+    self.assertEqual(g, 0)
+    self.assertEqual(h, "<html><head></head><body><p>\xa0</p></body></html>")
+
+  def test_html_dedupe(self):
+    a, b, c = db.execute("""select
+      html_dedupe('<div class="ad" id=x>Buy</div><p>a</p><div id=x class="ad">
+  Buy
+</div>', 'div'),
+      html_dedupe('<ul><li>a</li><li>b</li><li>a</li><li>A</li><li>b</li></ul>', 'li'),
+      html_dedupe('<p>a</p><p>b</p>', 'p')
+    """).fetchone()
+    self.assertEqual(a, '<div class="ad" id="x">Buy</div><p>a</p>')
+    self.assertEqual(b, '<ul><li>a</li><li>b</li><li>A</li></ul>')
+    self.assertEqual(c, '<p>a</p><p>b</p>')
+
+  def test_html_highlight(self):
+    a, b, c, d, e = db.execute("""select
+      html_highlight('<p title="cat">The cat sat on the <b>cat</b> mat</p>', 'p', 'cat'),
+      html_highlight('<p>Cats and cats</p>', 'p', 'cat', 'em', 1),
+      html_highlight('<div><p>cat</p><script>var cat;</script></div><p>cat</p>', 'div', 'cat'),
+      html_highlight('<p>a.b ab</p>', 'p', '.', null),
+      html_highlight('<p>cat</p>', 'p', '')
+    """).fetchone()
+    self.assertEqual(a, '<p title="cat">The <mark>cat</mark> sat on the <b><mark>cat</mark></b> mat</p>')
+    self.assertEqual(b, '<p><em>Cat</em>s and <em>cat</em>s</p>')
+    self.assertEqual(c, '<div><p><mark>cat</mark></p><script>var cat;</script></div><p>cat</p>')
+    self.assertEqual(d, '<p>a<mark>.</mark>b ab</p>')
+    self.assertEqual(e, '<p>cat</p>')
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "invalid wrapper_tag"):
+      db.execute("select html_highlight('<p>cat</p>', 'p', 'cat', '<b>')").fetchone()
+
+  def test_html_replace_text(self):
+    a, b, c, d, e = db.execute("""select
+      html_replace_text('<p title="Jane Doe">Call Jane Doe</p>', 'Jane Doe', '[redacted]'),
+      html_replace_text('<p>a</p><div>a <span>a</span></div>', 'a', 'b', 'div'),
+      html_replace_text('<p>1 < 2</p><script>if (1 < 2) {}</script>', '<', '&'),
+      html_replace_text('<b>b</b><p>b</p>', 'b', 'i', 'p, b'),
+      html_replace_text('<p>a</p>', '', 'x')
+    """).fetchone()
+    self.assertEqual(a, '<p title="Jane Doe">Call [redacted]</p>')
+    self.assertEqual(b, '<p>a</p><div>b <span>b</span></div>')
+    self.assertEqual(c, '<p>1 &amp; 2</p><script>if (1 < 2) {}</script>')
+    self.assertEqual(d, '<b>i</b><p>i</p>')
+    self.assertEqual(e, '<p>a</p>')
+
+  def test_html_remove_comments(self):
+    a, b, c = db.execute("""select
+      html_remove_comments('<p>a<!-- TODO: remove --></p><!--[if IE]><p>old</p><![endif]-->'),
+      html_remove_comments('<![if !IE]><p>new</p><![endif]><div><!--x--><span>b<!--y--></span></div>'),
+      html_remove_comments('<!-- top --><html><body><p>a</p></body></html>')
+    """).fetchone()
+    self.assertEqual(a, "<p>a</p>")
+    self.assertEqual(b, "<p>new</p><div><span>b</span></div>")
+    self.assertEqual(c, "<html><head></head><body><p>a</p></body></html>")
+
+  def test_html_clean_attributes(self):
+    a, b, c, d = db.execute("""select
+      html_clean_attributes('<a href="/x" onclick="track()" style="color: red">x</a>'),
+      html_clean_attributes('<a href="/x" onclick="track()" style="color: red">x</a>', 1),
+      html_clean_attributes('<html><body onLoad="init()"><div><img src=a.png onerror="x()" title="on"></div></body></html>'),
+      html_clean_attributes('<p one="1" data-on="2">a</p>')
+    """).fetchone()
+    self.assertEqual(a, '<a href="/x" style="color: red">x</a>')
+    self.assertEqual(b, '<a href="/x">x</a>')
+    self.assertEqual(c, '<html><head></head><body><div><img src="a.png" title="on"/></div></body></html>')
+    self.assertEqual(d, '<p data-on="2">a</p>')
+
+  def test_html_normalize_whitespace(self):
+    a, b, c, d = db.execute("""select
+      html_normalize_whitespace('<div>
+  <p>Hello,
+     world</p>
+  <pre>  keep
+  this</pre>
+</div>'),
+      html_normalize_whitespace('<p>a  &nbsp;  b</p><textarea>  x  </textarea><script>if (a)   b()</script>'),
+      html_normalize_whitespace('<p>a   b</p><div>c   d <span>e   f</span></div><pre>g   <b>h   i</b></pre>', 'div, b'),
+      html_normalize_whitespace('<html><head>  <title> t   t </title></head><body>  <p>x</p>  </body></html>')
+    """).fetchone()
+    self.assertEqual(a, '<div> <p>Hello, world</p> <pre>  keep\n  this</pre> </div>')
+    self.assertEqual(b, '<p>a \xa0 b</p><textarea>  x  </textarea><script>if (a)   b()</script>')
+    self.assertEqual(c, '<p>a   b</p><div>c d <span>e f</span></div><pre>g   <b>h   i</b></pre>')
+    self.assertEqual(d, '<html><head> <title> t t </title></head><body> <p>x</p> </body></html>')
+
+  def test_html_strip_empty(self):
+    a, b, c, d, e = db.execute("""select
+      html_strip_empty('<div><p> </p><div><span></span></div><p>a</p><p><img src=x.png></p></div>'),
+      html_strip_empty('<div> <div>&nbsp;<span><!-- x --></span> </div> </div><p>b<br></p>'),
+      html_strip_empty('<nav><p></p></nav><main><p></p><section><i></i></section></main>', 'main'),
+      html_strip_empty('<p>x<script src=a.js></script></p><table><tr><td></td></tr></table><textarea></textarea>'),
+      html_strip_empty('<html><head><title></title></head><body><p></p></body></html>')
+    """).fetchone()
+    self.assertEqual(a, '<div><p>a</p><p><img src="x.png"/></p></div>')
+    self.assertEqual(b, '<p>b<br/></p>')
+    self.assertEqual(c, '<nav><p></p></nav><main></main>')
+    self.assertEqual(d, '<p>x<script src="a.js"></script></p><table><tbody><tr><td></td></tr></tbody></table><textarea></textarea>')
+    self.assertEqual(e, '<html><head></head><body></body></html>')
+
+  def test_html_normalize(self):
+    a, b, c, d = db.execute("""select
+      html_normalize('<p id=a class=b>Hello   <b>world</b></p><br>'),
+      html_normalize('<html>
+  <body>
+    <p class="b" id="a">
+      Hello <b>world</b>
+    </p>
+    <br/>
+  </body>
+</html>'),
+      html_normalize('<ul> <li> <b>a</b> <i>b</i> </li> </ul>'),
+      html_normalize('<pre>  a
+  b</pre><!-- c -->')
+    """).fetchone()
+    self.assertEqual(a, '<html><head></head><body><p class="b" id="a">Hello <b>world</b></p><br/></body></html>')
+    self.assertEqual(b, a)
+    self.assertEqual(c, '<html><head></head><body><ul><li><b>a</b> <i>b</i></li></ul></body></html>')
+    self.assertEqual(d, '<html><head></head><body><pre>  a\n  b</pre><!-- c --></body></html>')
+
+  def test_html_hash(self):
+    import hashlib
+    normalized = "<html><head></head><body><p>a</p></body></html>"
+    a, b, c, d, e, f, g = db.execute("""select
+      html_hash('<p>a</p>'),
+      html_hash('<p>a</p>', 'sha1'),
+      html_hash('<p>a</p>', 'MD5'),
+      html_hash(html_parse('<html><body>
+  <p>a</p>
+</body></html>'), null),
+      html_hash('<p id=a class=b>Hello   world</p>') = html_hash('<p class="b" id="a">Hello world</p>'),
+      html_hash('<p>a</p>') = html_hash('<p>A</p>'),
+      html_hash('<p>a</p>', 'sha256')
+    """).fetchone()
+    self.assertEqual(a, hashlib.sha256(normalized.encode()).hexdigest())
+    self.assertEqual(b, hashlib.sha1(normalized.encode()).hexdigest())
+    self.assertEqual(c, hashlib.md5(normalized.encode()).hexdigest())
+    self.assertEqual(d, a)
+    self.assertEqual(e, 1)
+    self.assertEqual(f, 0)
+    self.assertEqual(g, a)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "unknown algorithm"):
+      db.execute("select html_hash('<p>a</p>', 'crc32')").fetchone()
+
+  def test_html_absolutize(self):
+    a, b, c, d = db.execute("""select
+      html_absolutize('<a href="../about">a</a><img src="img/x.png"/>', 'https://example.com/blog/post/'),
+      html_absolutize('<a href="https://other.com/x">a</a><a href="mailto:a@b.com">b</a><a href="javascript:void(0)">c</a>', 'https://example.com/'),
+      html_absolutize('<script src="//cdn.example.com/x.js"></script>', 'https://example.com/'),
+      html_absolutize('<img srcset="a.png 1x, /b.png 2x"/>', 'https://example.com/img/')
+    """).fetchone()
+    self.assertEqual(a, "<a href=\"https://example.com/blog/about\">a</a><img src=\"https://example.com/blog/post/img/x.png\"/>")
+    self.assertEqual(b, "<a href=\"https://other.com/x\">a</a><a href=\"mailto:a@b.com\">b</a><a href=\"javascript:void(0)\">c</a>")
+    self.assertEqual(c, "<script src=\"https://cdn.example.com/x.js\"></script>")
+    self.assertEqual(d, "<img srcset=\"https://example.com/img/a.png 1x, https://example.com/b.png 2x\"/>")
+
+    e = db.execute("""select
+      html_absolutize('<html><head><base href="https://example.com/docs/"></head><body><a href="intro">a</a></body></html>')
+    """).fetchone()[0]
+    self.assertEqual(e, "<html><head><base href=\"https://example.com/docs/\"/></head><body><a href=\"https://example.com/docs/intro\">a</a></body></html>")
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "no <base href>"):
+      db.execute("select html_absolutize('<a href=\"x\">a</a>')").fetchone()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "has no scheme"):
+      db.execute("select html_absolutize('<a href=\"x\">a</a>', '/docs/')").fetchone()
+    with self.assertRaisesRegex(sqlite3.OperationalError, "has no scheme"):
+      db.execute("select html_absolutize('<base href=\"example.com/docs/\"><a href=\"x\">a</a>')").fetchone()
+
+    # commas inside a srcset URL, like in data: URLs, don't split the candidate
+    f = db.execute("""select
+      html_absolutize('<img srcset="data:image/png;base64,iVBORw0KGgo= 1x, a.png 2x, b,c.png 3x,d.png"/>', 'https://example.com/')
+    """).fetchone()[0]
+    self.assertEqual(f, "<img srcset=\"data:image/png;base64,iVBORw0KGgo= 1x, https://example.com/a.png 2x, https://example.com/b,c.png 3x, https://example.com/d.png\"/>")
+
+  def test_html_rewrite_urls(self):
+    a, b, c, d = db.execute("""select
+      html_rewrite_urls('<img src="https://cdn.example.com/a.png" srcset="https://cdn.example.com/a@2x.png 2x,/b.png 3x"><a href="/about">About</a>', 'https://cdn.example.com/', 'https://proxy.local/cdn/'),
+      html_rewrite_urls('<img srcset="a.png 1x,b.png 2x"><link href=" /style.css" rel=stylesheet><script src="/app.js"></script>', '/', '/static/'),
+      html_rewrite_urls('<a href="HTTPS://example.com/x">a</a><a href="https://example.com.evil/x">b</a>', 'https://example.com/', '/'),
+      html_rewrite_urls('<a href="/x">a</a>', '', '/proxy')
+    """).fetchone()
+    self.assertEqual(a, '<img src="https://proxy.local/cdn/a.png" srcset="https://proxy.local/cdn/a@2x.png 2x, /b.png 3x"/><a href="/about">About</a>')
+    self.assertEqual(b, '<img srcset="a.png 1x,b.png 2x"/><link href="/static/style.css" rel="stylesheet"/><script src="/static/app.js"></script>')
+    self.assertEqual(c, '<a href="HTTPS://example.com/x">a</a><a href="https://example.com.evil/x">b</a>')
+    self.assertEqual(d, '<a href="/proxy/x">a</a>')
+
+  def test_html_set_base(self):
+    a, b, c, d, e = db.execute("""select
+      html_set_base('<p><a href="a.html">a</a></p>', 'https://example.com/docs/'),
+      html_set_base('<html><head><title>t</title><base href="/old/"><base href="/ignored/"></head><body></body></html>', '/new/'),
+      html_set_base('<head><base target="_blank"></head><p>a</p>', '/new/'),
+      html_base(html_set_base('<!DOCTYPE html><title>t</title>', 'https://example.com/')),
+      html_set_base(html_parse('<p>a</p>'), '/x/')
+    """).fetchone()
+    self.assertEqual(a, '<html><head><base href="https://example.com/docs/"/></head><body><p><a href="a.html">a</a></p></body></html>')
+    self.assertEqual(b, '<html><head><title>t</title><base href="/new/"/><base href="/ignored/"/></head><body></body></html>')
+    self.assertEqual(c, '<html><head><base target="_blank" href="/new/"/></head><body><p>a</p></body></html>')
+    self.assertEqual(d, "https://example.com/")
+    self.assertEqual(e, '<html><head><base href="/x/"/></head><body><p>a</p></body></html>')
+
+  def test_html_base(self):
+    a, b, c = db.execute("""select
+      html_base('<head><base target="_blank"><base href="https://example.com/docs/"><base href="/ignored/"></head>'),
+      html_base('<p>no base</p>'),
+      html_base('<base href="">')
+    """).fetchone()
+    self.assertEqual(a, "https://example.com/docs/")
+    self.assertEqual(b, None)
+    self.assertEqual(c, None)
+
+  def test_html_canonical(self):
+    a, b, c, d = db.execute("""select
+      html_canonical('<head><link rel="stylesheet" href="a.css"><link rel="Canonical" href="https://example.com/a"><link rel="canonical" href="/b"></head>'),
+      html_canonical('<head><link rel="alternate canonical" href="/c"></head>'),
+      html_canonical('<head><link rel="stylesheet" href="a.css"></head>'),
+      html_canonical('<link rel="canonical"><link rel="canonical" href="/d">')
+    """).fetchone()
+    self.assertEqual(a, "https://example.com/a")
+    self.assertEqual(b, "/c")
+    self.assertEqual(c, None)
+    self.assertEqual(d, "/d")
+
+  def test_html_text_length(self):
+    a, b, c, d, e = db.execute("""select
+      html_text_length('<p>Hello 世界</p><script>var a = 1;</script><style>p {}</style>', 'body'),
+      html_text_length('<p>Hello 世界</p>', 'p', 'bytes'),
+      html_text_length('<p>Hello 世界</p>', 'p', 'chars'),
+      html_text_length('<p>a</p>', 'span'),
+      html_text_length('<p>a &amp; b</p>', 'p', null)
+    """).fetchone()
+    self.assertEqual(a, 8)
+    self.assertEqual(b, 12)
+    self.assertEqual(c, 8)
+    self.assertEqual(d, 0)
+    self.assertEqual(e, 5)
+
+    with self.assertRaisesRegex(sqlite3.OperationalError, "unknown unit"):
+      db.execute("select html_text_length('<p>a</p>', 'p', 'words')").fetchone()
+
+  def test_html_word_count(self):
+    a, b, c, d = db.execute("""select
+      html_word_count('<p>The quick <b>brown</b>
+        fox</p><script>var a = 1;</script><style>p { color: red }</style>'),
+      html_word_count('<p>one two</p><div>three four five</div>', 'div'),
+      html_word_count('<p>Hello 世界</p>'),
+      html_word_count('<p>one</p>', 'div')
+    """).fetchone()
+    self.assertEqual(a, 4)
+    self.assertEqual(b, 3)
+    self.assertEqual(c, 3)
+    self.assertEqual(d, 0)
+
+  def test_selectors(self):
+    doc = '<ul><li class="a">one</li><li data-x="1"><b>two</b></li><li>three</li></ul>'
+    cases = {
+      'li:has(b)': ["two"],
+      'li:not(.a)': ["two", "three"],
+      'li:nth-child(3)': ["three"],
+      'li:nth-child(odd)': ["one", "three"],
+      'li[data-x="1"]': ["two"],
+      'li[class^=a]': ["one"],
+      'ul > li:not([data-x]):not(:has(b))': ["one", "three"],
+    }
+    for selector, expected in cases.items():
+      with self.subTest(selector=selector):
+        row = db.execute("""select
+          html_count(?1, ?2),
+          html_matches(?1, ?2),
+          html_text(?1, ?2),
+          html_text(html_extract(?1, ?2)),
+          html_text(html_nth(?1, ?2, -1)),
+          html_text_all(?1, ?2, '|'),
+          html_extract_all_text(?1, ?2, '|'),
+          html_count(html_remove(?1, ?2), 'li'),
+          html_count(html_add_class(?1, ?2, 'hit'), '.hit')
+        """, [doc, selector]).fetchone()
+        self.assertEqual(tuple(row), (
+          len(expected), 1, expected[0], expected[0], expected[-1],
+          "|".join(expected), "|".join(expected), 3 - len(expected), len(expected),
+        ))
+        each = db.execute("select text from html_each(?, ?)", [doc, selector]).fetchall()
+        self.assertEqual([x[0] for x in each], expected)
+        parsed = db.execute("select html_count(html_parse(?), ?)", [doc, selector]).fetchone()[0]
+        self.assertEqual(parsed, len(expected))
+
+    for sql in [
+      "select html_text('<p>a</p>', 'p[')",
+      "select html_count('<p>a</p>', 'p[')",
+      "select html_extract('<p>a</p>', 'p[', 1)",
+      "select html_remove('<p>a</p>', 'p[')",
+      "select html_attr_get('<p>a</p>', 'p[', 'id')",
+      "select html_closest('<p>a</p>', 'p', 'p[')",
+      "select html_count_stream(html_parse('<p>a</p>'), 'p[')",
+      "select * from html_each('<p>a</p>', 'p[')",
+      "select * from html_select_options('<p>a</p>', 'p[')",
+    ]:
+      with self.subTest(sql=sql):
+        with self.assertRaisesRegex(sqlite3.OperationalError, "invalid selector \"p\\[\""):
+          db.execute(sql).fetchall()
+
 class TestCoverage(unittest.TestCase):                                      
   def test_coverage(self):                                                      
     test_methods = [method for method in dir(TestHtml) if method.startswith('test_html')]
@@ -0,0 +1,845 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/augmentable-dev/vtab"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+)
+
+// visibleText returns the combined text of nodes like goquery's .Text(),
+// but skips the contents of <script> and <style> elements.
+func visibleText(nodes []*html.Node) string {
+	var buf strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			buf.WriteString(n.Data)
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return buf.String()
+}
+
+// textLength returns the length of the text of nodes like visibleText, counted in bytes
+// or in characters, without building the text itself.
+func textLength(nodes []*html.Node, bytes bool) int {
+	length := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			if bytes {
+				length += len(n.Data)
+			} else {
+				length += utf8.RuneCountInString(n.Data)
+			}
+		case html.ElementNode:
+			if n.Data == "script" || n.Data == "style" {
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return length
+}
+
+// wordCount counts the runs of non-whitespace characters in text. Chinese and
+// Japanese are written without spaces, so each of their characters counts as a word.
+func wordCount(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			count++
+			inWord = false
+		default:
+			if !inWord {
+				count++
+				inWord = true
+			}
+		}
+	}
+	return count
+}
+
+// Elements that start on a new line when rendered, used by html_text_lines.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "caption": true,
+	"dd": true, "details": true, "dialog": true, "div": true, "dl": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true, "table": true,
+	"title": true, "tr": true, "ul": true,
+}
+
+// textLines returns the visible text of nodes split into lines roughly like a
+// browser would render them: <br> and block-level elements start new lines,
+// table cells are separated by a space, and whitespace inside a line is collapsed.
+func textLines(nodes []*html.Node) []string {
+	var lines []string
+	var line strings.Builder
+	space := false
+
+	flush := func() {
+		lines = append(lines, line.String())
+		line.Reset()
+		space = false
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			for _, r := range n.Data {
+				if unicode.IsSpace(r) {
+					space = true
+					continue
+				}
+				if space && line.Len() > 0 {
+					line.WriteByte(' ')
+				}
+				space = false
+				line.WriteRune(r)
+			}
+			return
+		case html.ElementNode:
+			switch {
+			case n.Data == "script" || n.Data == "style":
+				return
+			case n.Data == "br":
+				flush()
+				return
+			case n.Data == "td" || n.Data == "th":
+				space = true
+			case blockElements[n.Data] && line.Len() > 0:
+				flush()
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if n.Type == html.ElementNode && blockElements[n.Data] && line.Len() > 0 {
+			flush()
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	if line.Len() > 0 {
+		flush()
+	}
+	return lines
+}
+
+/** html_text_lines(document [, selector])
+ * Returns the text contents of document, or of the first element matching selector,
+ * with a line break for every <br> and around every block-level element, approximating
+ * how the text is laid out when rendered. Whitespace inside each line is collapsed.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlTextLinesFunc struct {
+	nArgs int
+}
+
+func (*HtmlTextLinesFunc) Deterministic() bool { return true }
+func (h *HtmlTextLinesFunc) Args() int         { return h.nArgs }
+func (*HtmlTextLinesFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	nodes := doc.Nodes
+	if len(values) > 1 {
+		match, err := findFirst(doc.Selection, values[1].Text())
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		nodes = match.Nodes
+	}
+
+	c.ResultText(strings.Join(textLines(nodes), "\n"))
+}
+
+/** html_word_count(document [, selector])
+ * Returns the number of words in the visible text of document, or of the first element
+ * matching selector. Text inside <script> and <style> elements is skipped.
+ * Words are separated by Unicode whitespace, except Chinese and Japanese characters,
+ * which each count as a word. Returns 0 if no element matches selector.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+type HtmlWordCountFunc struct {
+	nArgs int
+}
+
+func (*HtmlWordCountFunc) Deterministic() bool { return true }
+func (h *HtmlWordCountFunc) Args() int         { return h.nArgs }
+func (*HtmlWordCountFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	nodes := doc.Nodes
+	if len(values) > 1 {
+		match, err := findFirst(doc.Selection, values[1].Text())
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		nodes = match.Nodes
+	}
+
+	c.ResultInt(wordCount(visibleText(nodes)))
+}
+
+/** html_text_length(document, selector [, unit])
+ * Returns the length of the visible text of the first element in document matching selector,
+ * in unit, which is either "chars" (the default) or "bytes". Text inside <script> and <style>
+ * elements is skipped. Returns 0 if no element matches selector.
+ * Raises an error if document is not proper HTML, or if unit is unknown.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param unit {text} - Either "chars" to count characters, or "bytes" to count UTF-8 bytes.
+ */
+type HtmlTextLengthFunc struct {
+	nArgs int
+}
+
+func (*HtmlTextLengthFunc) Deterministic() bool { return true }
+func (h *HtmlTextLengthFunc) Args() int         { return h.nArgs }
+func (*HtmlTextLengthFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	bytes := false
+	if len(values) > 2 && values[2].Type() != sqlite.SQLITE_NULL {
+		switch unit := values[2].Text(); unit {
+		case "chars":
+		case "bytes":
+			bytes = true
+		default:
+			c.ResultError(fmt.Errorf("unknown unit %q, expected 'chars' or 'bytes'", unit))
+			return
+		}
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultInt(textLength(match.Nodes, bytes))
+}
+
+/** html_first_text(document, selector, default)
+ * Returns the text contents of the first element in document matching selector,
+ * or default if no element matches.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param default {text} - Text to return when selector matches nothing.
+ */
+type HtmlFirstTextFunc struct{}
+
+func (*HtmlFirstTextFunc) Deterministic() bool { return true }
+func (*HtmlFirstTextFunc) Args() int           { return 3 }
+func (*HtmlFirstTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() > 0 {
+		c.ResultText(match.Text())
+	} else if values[2].Type() == sqlite.SQLITE_NULL {
+		c.ResultNull()
+	} else {
+		c.ResultText(values[2].Text())
+	}
+}
+
+// truncateText shortens text to at most max characters, cutting at the last whitespace
+// at or before max so words aren't split, and appends ellipsis if anything was cut.
+// A single word longer than max is cut mid-word.
+func truncateText(text string, max int, ellipsis string) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	cut := max
+	if !unicode.IsSpace(runes[max]) {
+		for i := max; i > 0; i-- {
+			if unicode.IsSpace(runes[i-1]) {
+				cut = i - 1
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + ellipsis
+}
+
+/** html_truncate_text(document, selector, max_chars [, ellipsis])
+ * Returns the text contents of the first element in document matching selector, truncated
+ * to at most max_chars characters on a word boundary, with ellipsis appended if it was truncated.
+ * Returns NULL if no element matches.
+ * Raises an error if document is not proper HTML, or if max_chars is negative.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param max_chars {integer} - Maximum number of characters to keep, not counting the ellipsis.
+ * @param ellipsis {text} - Text appended when the text is truncated, defaults to "…".
+ */
+type HtmlTruncateTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlTruncateTextFunc) Deterministic() bool { return true }
+func (h *HtmlTruncateTextFunc) Args() int         { return h.nArgs }
+func (*HtmlTruncateTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	max := values[2].Int()
+	ellipsis := "…"
+	if len(values) > 3 {
+		ellipsis = values[3].Text()
+	}
+
+	if max < 0 {
+		c.ResultError(errors.New("max_chars must not be negative"))
+		return
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	if match.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	c.ResultText(truncateText(match.Text(), max, ellipsis))
+}
+
+/** html_next_text(document, selector)
+ *  html_prev_text(document, selector)
+ * Returns the text contents of the element immediately after (or before) the first element
+ * in document matching selector, skipping over text and comments between them.
+ * Returns NULL if no element matches, or if it has no such sibling element.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to start from.
+ */
+type HtmlSiblingTextFunc struct {
+	prev bool
+}
+
+func (*HtmlSiblingTextFunc) Deterministic() bool { return true }
+func (*HtmlSiblingTextFunc) Args() int           { return 2 }
+func (h *HtmlSiblingTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	match, err := findFirst(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	var sibling *goquery.Selection
+	if h.prev {
+		sibling = match.Prev()
+	} else {
+		sibling = match.Next()
+	}
+
+	if sibling.Length() == 0 {
+		c.ResultNull()
+		return
+	}
+
+	c.ResultText(sibling.Text())
+}
+
+// accessibleText returns the text of nodes closer to what a screen reader announces:
+// images are replaced with their alt text, and, if titles is set, every element's
+// title is appended in parentheses after its contents. Contents of <script>,
+// <style>, and <template> elements, and elements with the hidden attribute or
+// aria-hidden="true", are skipped.
+func accessibleText(nodes []*html.Node, titles bool) string {
+	var buf strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+			return
+		}
+		if n.Type != html.ElementNode {
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+			return
+		}
+
+		switch n.Data {
+		case "script", "style", "template":
+			return
+		}
+		ariaHidden, _ := nodeAttr(n, "aria-hidden")
+		if _, hidden := nodeAttr(n, "hidden"); hidden || ariaHidden == "true" {
+			return
+		}
+
+		start := buf.Len()
+		inputType, _ := nodeAttr(n, "type")
+		if n.Data == "img" || n.Data == "area" || (n.Data == "input" && strings.EqualFold(inputType, "image")) {
+			alt, _ := nodeAttr(n, "alt")
+			buf.WriteString(alt)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+
+		title, _ := nodeAttr(n, "title")
+		if title = strings.TrimSpace(title); titles && title != "" {
+			// skip titles that only repeat what was already announced
+			if strings.TrimSpace(buf.String()[start:]) != title {
+				buf.WriteString(" (" + title + ")")
+			}
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	return buf.String()
+}
+
+/** html_accessible_text(document [, selector [, include_titles]])
+ * Returns the text contents of document, or of the first element matching selector, like html_text
+ * but closer to what assistive technology announces: images are replaced by their alt text,
+ * hidden elements are skipped, and if include_titles is true, title attributes are appended in parentheses.
+ * Returns NULL if no element matches selector.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ * @param include_titles {integer} - Whether to append the title attribute of elements, defaults to 0.
+ */
+type HtmlAccessibleTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlAccessibleTextFunc) Deterministic() bool { return true }
+func (h *HtmlAccessibleTextFunc) Args() int         { return h.nArgs }
+func (*HtmlAccessibleTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	nodes := doc.Nodes
+	if len(values) > 1 {
+		match, err := findFirst(doc.Selection, values[1].Text())
+		if err != nil {
+			c.ResultError(err)
+			return
+		}
+		nodes = match.Nodes
+		if len(nodes) == 0 {
+			c.ResultNull()
+			return
+		}
+	}
+	titles := len(values) > 2 && values[2].Int() != 0
+
+	c.ResultText(accessibleText(nodes, titles))
+}
+
+/** html_contains_text(document, selector, needle [, case_insensitive])
+ * Returns 1 if the text of any element in document matching selector contains needle, 0 otherwise.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to search.
+ * @param needle {text} - Text to search for.
+ * @param case_insensitive {integer} - Whether to ignore case when comparing, defaults to 0.
+ */
+type HtmlContainsTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlContainsTextFunc) Deterministic() bool { return true }
+func (h *HtmlContainsTextFunc) Args() int         { return h.nArgs }
+func (*HtmlContainsTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	needle := values[2].Text()
+	caseInsensitive := len(values) > 3 && values[3].Int() != 0
+	if caseInsensitive {
+		needle = strings.ToLower(needle)
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	match := matches.FilterFunction(func(i int, s *goquery.Selection) bool {
+		text := s.Text()
+		if caseInsensitive {
+			text = strings.ToLower(text)
+		}
+		return strings.Contains(text, needle)
+	})
+
+	if match.Length() > 0 {
+		c.ResultInt(1)
+	} else {
+		c.ResultInt(0)
+	}
+}
+
+/** html_text_all(document, selector, separator)
+ * Returns the text contents of every element in document matching selector,
+ * joined together with separator.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ * @param separator {text} - Text placed between the text of each element.
+ */
+type HtmlTextAllFunc struct{}
+
+func (*HtmlTextAllFunc) Deterministic() bool { return true }
+func (*HtmlTextAllFunc) Args() int           { return 3 }
+func (*HtmlTextAllFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	separator := values[2].Text()
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	texts := matches.Map(func(i int, s *goquery.Selection) string {
+		return s.Text()
+	})
+
+	c.ResultText(strings.Join(texts, separator))
+}
+
+/** html_extract_all_text(document, selector [, separator])
+ * Returns the text contents of every element in document matching selector, with runs of whitespace
+ * in each element's text collapsed to a single space and leading and trailing whitespace trimmed,
+ * joined together with separator. Elements without any text are skipped.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which elements in document to read.
+ * @param separator {text} - Text placed between the text of each element, defaults to a newline.
+ */
+type HtmlExtractAllTextFunc struct {
+	nArgs int
+}
+
+func (*HtmlExtractAllTextFunc) Deterministic() bool { return true }
+func (h *HtmlExtractAllTextFunc) Args() int         { return h.nArgs }
+func (*HtmlExtractAllTextFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	selector := values[1].Text()
+	separator := "\n"
+	if len(values) > 2 && values[2].Type() != sqlite.SQLITE_NULL {
+		separator = values[2].Text()
+	}
+
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	matches, err := findAll(doc.Selection, selector)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	var texts []string
+	matches.Each(func(i int, s *goquery.Selection) {
+		if text := strings.Join(strings.Fields(s.Text()), " "); text != "" {
+			texts = append(texts, text)
+		}
+	})
+
+	c.ResultText(strings.Join(texts, separator))
+}
+
+// Elements that html_text_blocks splits text into.
+var textBlockElements = map[string]bool{
+	"p": true, "li": true, "blockquote": true, "pre": true, "td": true, "th": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// blockText returns the text of the block element n with whitespace collapsed and trimmed,
+// leaving out the text of the blocks nested inside it, and of <script> and <style> elements.
+func blockText(n *html.Node) string {
+	var buf strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			switch child.Type {
+			case html.TextNode:
+				buf.WriteString(child.Data)
+			case html.ElementNode:
+				if child.Data == "script" || child.Data == "style" || textBlockElements[child.Data] {
+					// keep the words on either side of a nested block apart
+					buf.WriteByte(' ')
+					continue
+				}
+				walk(child)
+			}
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+/** html_text_blocks(document [, selector])
+ * A table value function returning a row for every block of text in document, or inside the
+ * first element matching selector: every <p>, <li>, <blockquote>, <pre>, <td>, <th>, and heading,
+ * in document order. Text of nested blocks is only part of the innermost block, and blocks
+ * without any text are skipped.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ * @param selector {text} - CSS-style selector of which element in document to read.
+ */
+var HtmlTextBlocksColumns = []vtab.Column{
+	{Name: "document", Type: sqlite.SQLITE_TEXT.String(), NotNull: true, Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, Required: true, OmitCheck: true}}},
+	{Name: "selector", Type: sqlite.SQLITE_TEXT.String(), Hidden: true, Filters: []*vtab.ColumnFilter{{Op: sqlite.INDEX_CONSTRAINT_EQ, OmitCheck: true}}},
+
+	{Name: "block_index", Type: sqlite.SQLITE_INTEGER.String()},
+	{Name: "tag", Type: sqlite.SQLITE_TEXT.String()},
+	{Name: "text", Type: sqlite.SQLITE_TEXT.String()},
+}
+
+type textBlock struct {
+	tag  string
+	text string
+}
+
+type HtmlTextBlocksCursor struct {
+	current int
+
+	blocks []textBlock
+}
+
+func (cur *HtmlTextBlocksCursor) Column(ctx *sqlite.Context, c int) error {
+	block := cur.blocks[cur.current]
+
+	col := HtmlTextBlocksColumns[c].Name
+	switch col {
+	case "document":
+		ctx.ResultText("")
+	case "selector":
+		ctx.ResultText("")
+
+	case "block_index":
+		ctx.ResultInt(cur.current)
+	case "tag":
+		ctx.ResultText(block.tag)
+	case "text":
+		ctx.ResultText(block.text)
+	}
+	return nil
+}
+
+func (cur *HtmlTextBlocksCursor) Next() (vtab.Row, error) {
+	cur.current += 1
+	if cur.current >= len(cur.blocks) {
+		return nil, io.EOF
+	}
+	return cur, nil
+}
+
+func HtmlTextBlocksIterator(constraints []*vtab.Constraint, order []*sqlite.OrderBy) (vtab.Iterator, error) {
+	document, selector := htmlEachArgs(constraints)
+
+	doc, err := documentArg(document)
+	if err != nil {
+		return nil, fmt.Errorf("html_text_blocks: failed to parse document: %w", err)
+	}
+
+	scope := doc.Selection
+	if selector != "" {
+		if scope, err = findFirst(doc.Selection, selector); err != nil {
+			return nil, fmt.Errorf("html_text_blocks: %w", err)
+		}
+	}
+
+	var blocks []textBlock
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode && n.Type != html.DocumentNode {
+			return
+		}
+		if n.Data == "script" || n.Data == "style" {
+			return
+		}
+		if n.Type == html.ElementNode && textBlockElements[n.Data] {
+			if text := blockText(n); text != "" {
+				blocks = append(blocks, textBlock{tag: n.Data, text: text})
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range scope.Nodes {
+		walk(n)
+	}
+	current := -1
+
+	return &HtmlTextBlocksCursor{
+		current: current,
+		blocks:  blocks,
+	}, nil
+}
+
+func RegisterText(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_accessible_text", &HtmlAccessibleTextFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_accessible_text", &HtmlAccessibleTextFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_accessible_text", &HtmlAccessibleTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_contains_text", &HtmlContainsTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_contains_text", &HtmlContainsTextFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_all_text", &HtmlExtractAllTextFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_extract_all_text", &HtmlExtractAllTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_first_text", &HtmlFirstTextFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_next_text", &HtmlSiblingTextFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_prev_text", &HtmlSiblingTextFunc{prev: true}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_all", &HtmlTextAllFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_length", &HtmlTextLengthFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_length", &HtmlTextLengthFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_lines", &HtmlTextLinesFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_text_lines", &HtmlTextLinesFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_truncate_text", &HtmlTruncateTextFunc{nArgs: 3}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_truncate_text", &HtmlTruncateTextFunc{nArgs: 4}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_word_count", &HtmlWordCountFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_word_count", &HtmlWordCountFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateModule("html_text_blocks", vtab.NewTableFunc("html_text_blocks", HtmlTextBlocksColumns, HtmlTextBlocksIterator)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rewriteUrls calls rewrite on every URL found in the href, src, and srcset
+// attributes of doc, replacing each URL with the returned value.
+func rewriteUrls(doc *goquery.Document, rewrite func(string) string) {
+	for _, node := range doc.Find("[href], [src], [srcset]").Nodes {
+		for i, attr := range node.Attr {
+			switch attr.Key {
+			case "href", "src":
+				node.Attr[i].Val = rewrite(attr.Val)
+			case "srcset":
+				node.Attr[i].Val = rewriteSrcset(attr.Val, rewrite)
+			}
+		}
+	}
+}
+
+// srcsetCandidate is one image candidate of a srcset attribute, like "a.png 2x".
+type srcsetCandidate struct {
+	url         string
+	descriptors []string
+}
+
+// parseSrcset splits a srcset attribute into its image candidates, like browsers do.
+// A candidate's URL runs up to the next whitespace, so it can contain commas, like
+// data: URLs do, and its descriptors run up to the next comma outside of parentheses.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	pos := 0
+	for {
+		// candidates are separated by commas, with any whitespace around them
+		for pos < len(srcset) && (srcset[pos] == ',' || strings.IndexByte("\t\n\f\r ", srcset[pos]) >= 0) {
+			pos++
+		}
+		if pos == len(srcset) {
+			return candidates
+		}
+		start := pos
+		for pos < len(srcset) && strings.IndexByte("\t\n\f\r ", srcset[pos]) < 0 {
+			pos++
+		}
+		// commas at the end of the URL end the candidate, without descriptors
+		href := strings.TrimRight(srcset[start:pos], ",")
+		if len(href) < pos-start {
+			candidates = append(candidates, srcsetCandidate{url: href})
+			continue
+		}
+		start = pos
+		inParens := false
+		for pos < len(srcset) && (inParens || srcset[pos] != ',') {
+			switch srcset[pos] {
+			case '(':
+				inParens = true
+			case ')':
+				inParens = false
+			}
+			pos++
+		}
+		candidates = append(candidates, srcsetCandidate{url: href, descriptors: strings.Fields(srcset[start:pos])})
+	}
+}
+
+// rewriteSrcset rewrites the URL of every candidate in a srcset attribute,
+// like "a.png 1x, b.png 2x", keeping the width/density descriptors.
+// If no URL changes, srcset is returned as written.
+func rewriteSrcset(srcset string, rewrite func(string) string) string {
+	changed := false
+	candidates := parseSrcset(srcset)
+	rewritten := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		if href := rewrite(candidate.url); href != candidate.url {
+			candidate.url = href
+			changed = true
+		}
+		rewritten[i] = strings.Join(append([]string{candidate.url}, candidate.descriptors...), " ")
+	}
+	if !changed {
+		return srcset
+	}
+	return strings.Join(rewritten, ", ")
+}
+
+// documentBase returns the href of the first <base> element in doc, and whether there is one.
+func documentBase(doc *goquery.Document) (string, bool) {
+	return doc.Find("base[href]").First().Attr("href")
+}
+
+/** html_base(document)
+ * Returns the href of the first <base> element in document, or NULL if it has none.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ */
+type HtmlBaseFunc struct{}
+
+func (*HtmlBaseFunc) Deterministic() bool { return true }
+func (*HtmlBaseFunc) Args() int           { return 1 }
+func (*HtmlBaseFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	if href, ok := documentBase(doc.Document); ok {
+		c.ResultText(href)
+	} else {
+		c.ResultNull()
+	}
+}
+
+// isCanonicalLink reports whether s is a <link> with "canonical" among its rel keywords.
+func isCanonicalLink(i int, s *goquery.Selection) bool {
+	for _, rel := range strings.Fields(s.AttrOr("rel", "")) {
+		if strings.EqualFold(rel, "canonical") {
+			return true
+		}
+	}
+	return false
+}
+
+/** html_canonical(document)
+ * Returns the href of the first <link rel="canonical"> element in document, or NULL if it has none.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to read from.
+ */
+type HtmlCanonicalFunc struct{}
+
+func (*HtmlCanonicalFunc) Deterministic() bool { return true }
+func (*HtmlCanonicalFunc) Args() int           { return 1 }
+func (*HtmlCanonicalFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := documentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	link := doc.Find("link[rel][href]").FilterFunction(isCanonicalLink).First()
+	if href, ok := link.Attr("href"); ok {
+		c.ResultText(href)
+	} else {
+		c.ResultNull()
+	}
+}
+
+/** html_absolutize(document [, base_url])
+ * Resolves every relative URL in the href, src, and srcset attributes of document
+ * against base_url, and returns the modified document. Without base_url, the href of
+ * the document's own <base> element is used.
+ * Already-absolute URLs and URLs with other schemes (mailto:, tel:, javascript:) are left untouched.
+ * Raises an error if document is not proper HTML, if base_url (or the <base href>) is not
+ * a valid URL with a scheme, or if base_url is missing and document has no <base href>.
+ * @param document {text | html} - HTML document to modify.
+ * @param base_url {text} - URL that relative URLs are resolved against.
+ */
+type HtmlAbsolutizeFunc struct {
+	nArgs int
+}
+
+func (*HtmlAbsolutizeFunc) Deterministic() bool { return true }
+func (h *HtmlAbsolutizeFunc) Args() int         { return h.nArgs }
+func (*HtmlAbsolutizeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	var rawBase string
+	if len(values) > 1 {
+		rawBase = values[1].Text()
+	} else if href, ok := documentBase(doc.Document); ok {
+		rawBase = href
+	} else {
+		c.ResultError(errors.New("document has no <base href>, pass a base_url instead"))
+		return
+	}
+
+	base, err := url.Parse(rawBase)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	// resolving against a base without a scheme would leave every URL relative
+	if !base.IsAbs() {
+		c.ResultError(fmt.Errorf("base URL %q has no scheme", rawBase))
+		return
+	}
+
+	rewriteUrls(doc.Document, func(raw string) string {
+		ref, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || raw == "" || ref.Scheme != "" {
+			return raw
+		}
+		return base.ResolveReference(ref).String()
+	})
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_rewrite_urls(document, from_prefix, to_prefix)
+ * Replaces from_prefix with to_prefix at the start of every URL in the href, src, and srcset
+ * attributes of document, and returns the modified document. URLs that don't start with
+ * from_prefix are left untouched.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param from_prefix {text} - Start of the URLs to rewrite.
+ * @param to_prefix {text} - Text that replaces from_prefix.
+ */
+type HtmlRewriteUrlsFunc struct{}
+
+func (*HtmlRewriteUrlsFunc) Deterministic() bool { return true }
+func (*HtmlRewriteUrlsFunc) Args() int           { return 3 }
+func (*HtmlRewriteUrlsFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	from := values[1].Text()
+	to := values[2].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	rewriteUrls(doc.Document, func(raw string) string {
+		trimmed := strings.TrimSpace(raw)
+		if !strings.HasPrefix(trimmed, from) {
+			return raw
+		}
+		return to + strings.TrimPrefix(trimmed, from)
+	})
+
+	out, err := renderDocument(doc)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+/** html_set_base(document, base_url)
+ * Sets the href of the first <base> element in document to base_url, or inserts a <base href> at
+ * the start of its <head> if it has none, and returns the modified document. The result is always
+ * a full document, since a fragment has no <head> to hold a <base>.
+ * Raises an error if document is not proper HTML.
+ * @param document {text | html} - HTML document to modify.
+ * @param base_url {text} - URL that relative URLs in document should resolve against.
+ */
+type HtmlSetBaseFunc struct{}
+
+func (*HtmlSetBaseFunc) Deterministic() bool { return true }
+func (*HtmlSetBaseFunc) Args() int           { return 2 }
+func (*HtmlSetBaseFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	href := values[1].Text()
+
+	doc, err := modifiableDocumentArg(values[0])
+
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	// browsers only use the first <base href>, so that's the one to replace,
+	// and a <base> with only a target can take an href too
+	base := doc.Find("base[href]").First()
+	if base.Length() == 0 {
+		base = doc.Find("base").First()
+	}
+	if base.Length() > 0 {
+		base.SetAttr("href", href)
+	} else {
+		// the parser always adds a <head>, even when document doesn't have one
+		head := doc.Find("head").Get(0)
+		node := &html.Node{Type: html.ElementNode, Data: "base", DataAtom: atom.Base, Attr: []html.Attribute{{Key: "href", Val: href}}}
+		head.InsertBefore(node, head.FirstChild)
+	}
+
+	out, err := goquery.OuterHtml(doc.Selection)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+
+	c.ResultText(out)
+	c.ResultSubType(HTML_SUBTYPE)
+}
+
+func RegisterUrls(api *sqlite.ExtensionApi) error {
+	var err error
+	if err = api.CreateFunction("html_base", &HtmlBaseFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_canonical", &HtmlCanonicalFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_absolutize", &HtmlAbsolutizeFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_absolutize", &HtmlAbsolutizeFunc{nArgs: 2}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_rewrite_urls", &HtmlRewriteUrlsFunc{}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_set_base", &HtmlSetBaseFunc{}); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,9 +4,10 @@ import (
 	"fmt"
 	"html"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/PuerkitoBio/goquery"
 	"go.riyazali.net/sqlite"
+	"golang.org/x/net/html/charset"
 )
 
 /**	html_valid(document)
@@ -18,8 +19,7 @@ import (
  func (*HtmlValidFunc) Deterministic() bool { return true }
  func (*HtmlValidFunc) Args() int           { return 1 }
  func (*HtmlValidFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
-	 html := values[0].Text()
-	 _, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	 _, err := documentArg(values[0])
  
 	 if err != nil {
 		 c.ResultInt(0)
@@ -41,7 +41,9 @@ func (*HtmlEscapeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
 }
 
  /**	html_unescape(content)
- * Returns an HTML unescaped version of the given content.
+ *	html_decode_entities(content)
+ * Returns an HTML unescaped version of the given content. Named entities and decimal or hex
+ * numeric references are decoded, including code points outside the Basic Multilingual Plane.
  * @param content {text} - Text content to unescape.
  **/
  type HtmlUnescapeFunc struct{}
@@ -79,6 +81,60 @@ func (*HtmlTableFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
 	c.ResultText(fmt.Sprintf("<table>%s", s))
 }
 
+// decodeHtml transcodes the raw bytes of an HTML document into UTF-8 text.
+// When label is empty, the encoding is sniffed from a byte order mark or a
+// <meta charset> / http-equiv declaration in the first 1024 bytes.
+func decodeHtml(content []byte, label string) (string, error) {
+	if label == "" {
+		e, name, certain := charset.DetermineEncoding(content, "")
+		// DetermineEncoding falls back to windows-1252 when nothing is declared,
+		// which would mangle UTF-8 documents that are plain ASCII up front.
+		if certain || name != "windows-1252" || !utf8.Valid(content) {
+			decoded, err := e.NewDecoder().Bytes(content)
+			if err != nil {
+				return "", err
+			}
+			content = decoded
+		}
+	} else {
+		e, _ := charset.Lookup(label)
+		if e == nil {
+			return "", fmt.Errorf("unknown charset %q", label)
+		}
+		decoded, err := e.NewDecoder().Bytes(content)
+		if err != nil {
+			return "", err
+		}
+		content = decoded
+	}
+	return strings.TrimPrefix(string(content), "\ufeff"), nil
+}
+
+/**	html_decode(document [, charset])
+ * Decodes the raw bytes of an HTML document into UTF-8 text. Without a charset,
+ * the encoding is sniffed from a byte order mark or a <meta charset> declaration.
+ * @param document {blob | text} - Raw bytes of an HTML document.
+ * @param charset {text} - Optional encoding label, like "windows-1252" or "shift_jis".
+ **/
+type HtmlDecodeFunc struct {
+	nArgs int
+}
+
+func (*HtmlDecodeFunc) Deterministic() bool { return true }
+func (h *HtmlDecodeFunc) Args() int         { return h.nArgs }
+func (*HtmlDecodeFunc) Apply(c *sqlite.Context, values ...sqlite.Value) {
+	label := ""
+	if len(values) > 1 {
+		label = values[1].Text()
+	}
+	decoded, err := decodeHtml(values[0].Blob(), label)
+	if err != nil {
+		c.ResultError(err)
+		return
+	}
+	c.ResultText(decoded)
+}
+
 func RegisterUtils(api *sqlite.ExtensionApi) error {
 	var err error
 	if err = api.CreateFunction("html_valid", &HtmlValidFunc{}); err != nil {
@@ -93,8 +149,17 @@ func RegisterUtils(api *sqlite.ExtensionApi) error {
 	if err = api.CreateFunction("html_unescape", &HtmlUnescapeFunc{}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_decode_entities", &HtmlUnescapeFunc{}); err != nil {
+		return err
+	}
 	if err = api.CreateFunction("html_trim", &HtmlTrimFunc{}); err != nil {
 		return err
 	}
+	if err = api.CreateFunction("html_decode", &HtmlDecodeFunc{nArgs: 1}); err != nil {
+		return err
+	}
+	if err = api.CreateFunction("html_decode", &HtmlDecodeFunc{nArgs: 2}); err != nil {
+		return err
+	}
 	return nil
 }